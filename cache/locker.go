@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	_ Locker = &Client{}
+	_ Locker = &MemoryLocker{}
+)
+
+// Locker 锁的抽象，业务代码应该依赖这个接口，而不是具体的实现
+// 续约和释放通过返回的 Lock 完成，不同的实现下 Lock.Refresh 和 Lock.UnLock 的语义保持一致
+// 目前有两个实现：
+// 1. Client，基于 redis
+// 2. MemoryLocker，基于进程内存，主要用于测试
+type Locker interface {
+	// Lock 支持重试上锁，参数的含义参考 Client.Lock
+	Lock(ctx context.Context,
+		key string,
+		expiration time.Duration,
+		timeout time.Duration,
+		retry RetryStrategy) (*Lock, error)
+	// TryLock 只尝试一次，拿不到锁返回 ErrFailedToPreemptLock
+	TryLock(ctx context.Context, key string, expiration time.Duration) (*Lock, error)
+}
+
+// lockStore 锁的存储，Lock 通过它完成续约和释放
+// 返回值和 lua 脚本保持一致：1 表示成功，0 表示没有持有锁
+type lockStore interface {
+	refresh(ctx context.Context, key, value string, expiration time.Duration) (int64, error)
+	unlock(ctx context.Context, key, value string) (int64, error)
+}
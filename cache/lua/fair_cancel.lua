@@ -0,0 +1,15 @@
+-- KEYS[1] 锁 KEYS[2] 排队集合 KEYS[3] 排队超时集合 KEYS[4] 自己的通知列表
+-- ARGV[1] 唯一值 ARGV[2] 通知列表前缀 ARGV[3] 通知的过期时间（毫秒）
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('DEL', KEYS[4])
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    -- 自己放弃了，锁又是空闲的，唤醒下一个排队者
+    local head = redis.call('ZRANGE', KEYS[2], 0, 0)
+    if head[1] ~= nil then
+        local notify = ARGV[2] .. head[1]
+        redis.call('RPUSH', notify, 1)
+        redis.call('PEXPIRE', notify, ARGV[3])
+    end
+end
+return 1
@@ -0,0 +1,38 @@
+-- KEYS[1] 锁 KEYS[2] 排队集合，score 为排队顺序 KEYS[3] 排队超时集合，score 为超时时间（毫秒）
+-- KEYS[4] 自己的通知列表 KEYS[5] fencing token 计数器
+-- ARGV[1] 唯一值 ARGV[2] 锁过期时间（毫秒） ARGV[3] 排队超时时间（毫秒）
+-- 加锁成功返回 fencing token，否则返回 0
+local t = redis.call('TIME')
+local nowUs = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local now = math.floor(nowUs / 1000)
+-- 清理已经超时的排队者，避免宕机的排队者一直挡在前面
+local dead = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', now)
+for _, v in ipairs(dead) do
+    redis.call('ZREM', KEYS[2], v)
+    redis.call('ZREM', KEYS[3], v)
+end
+local val = redis.call('GET', KEYS[1])
+if val == ARGV[1] then
+    -- 锁存在，且当前是加自己的锁
+    redis.call('PEXPIRE', KEYS[1], ARGV[2])
+    local token = redis.call('GET', KEYS[5])
+    if token == false then
+        return redis.call('INCR', KEYS[5])
+    end
+    return tonumber(token)
+end
+if val == false then
+    local head = redis.call('ZRANGE', KEYS[2], 0, 0)
+    if head[1] == nil or head[1] == ARGV[1] then
+        -- 锁空闲，并且轮到自己
+        redis.call('ZREM', KEYS[2], ARGV[1])
+        redis.call('ZREM', KEYS[3], ARGV[1])
+        redis.call('DEL', KEYS[4])
+        redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+        return redis.call('INCR', KEYS[5])
+    end
+end
+-- 排队，已经在队列里面的保持原来的位置
+redis.call('ZADD', KEYS[2], 'NX', nowUs, ARGV[1])
+redis.call('ZADD', KEYS[3], now + tonumber(ARGV[3]), ARGV[1])
+return 0
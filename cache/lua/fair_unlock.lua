@@ -0,0 +1,14 @@
+-- KEYS[1] 锁 KEYS[2] 排队集合
+-- ARGV[1] 唯一值 ARGV[2] 通知列表前缀 ARGV[3] 通知的过期时间（毫秒）
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+redis.call('DEL', KEYS[1])
+-- 唤醒队首的排队者
+local head = redis.call('ZRANGE', KEYS[2], 0, 0)
+if head[1] ~= nil then
+    local notify = ARGV[2] .. head[1]
+    redis.call('RPUSH', notify, 1)
+    redis.call('PEXPIRE', notify, ARGV[3])
+end
+return 1
@@ -1,13 +1,22 @@
-val = redis.call('get', KEYS[1])
+-- KEYS[1] 锁 KEYS[2] fencing token 计数器
+-- ARGV[1] 唯一值 ARGV[2] 过期时间（毫秒）
+-- 加锁成功返回 fencing token，被别人拿着返回 0
+local val = redis.call('get', KEYS[1])
 -- 注意:redis返回类型转lua脚本类型
 if val == false then
     -- 锁不存在
-    return redis.call('set', KEYS[1], ARGV[1], 'nx', ARGV[2])
+    redis.call('set', KEYS[1], ARGV[1], 'px', ARGV[2])
+    return redis.call('incr', KEYS[2])
 elseif val == ARGV[1] then
     -- 锁存在，且当前是加自己的锁
-    redis.call('expire', KEYS[1], ARGV[2])
-    return 'OK'
+    -- 自己持有锁期间别人不可能加锁，所以计数器的值就是自己的 token
+    redis.call('pexpire', KEYS[1], ARGV[2])
+    local token = redis.call('get', KEYS[2])
+    if token == false then
+        return redis.call('incr', KEYS[2])
+    end
+    return tonumber(token)
 else
     -- 锁被别人拿着
-    return ''
-end
\ No newline at end of file
+    return 0
+end
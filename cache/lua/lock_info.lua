@@ -0,0 +1,7 @@
+-- KEYS[1] 锁
+-- 锁不存在返回空，否则返回 {唯一值, 剩余过期时间（毫秒）}
+local val = redis.call('get', KEYS[1])
+if val == false then
+    return {}
+end
+return {val, redis.call('pttl', KEYS[1])}
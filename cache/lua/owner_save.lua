@@ -0,0 +1,5 @@
+-- KEYS[1] 持有者元数据
+-- ARGV[1] 过期时间（毫秒），后面是 field value 对
+redis.call('hset', KEYS[1], unpack(ARGV, 2))
+redis.call('pexpire', KEYS[1], ARGV[1])
+return 1
@@ -0,0 +1,15 @@
+-- KEYS[1] 锁
+-- ARGV[1] 唯一值 ARGV[2] 过期时间（毫秒）
+-- 加锁成功返回 1，被别人拿着返回 0
+-- 和 lock.lua 不同，这里不维护 fencing token：不同节点上的计数器之间没有可比性，
+-- 而且计数器不会过期，每个 key 都会在所有节点上留下一个垃圾 key
+local val = redis.call('get', KEYS[1])
+if val == false then
+    redis.call('set', KEYS[1], ARGV[1], 'px', ARGV[2])
+    return 1
+elseif val == ARGV[1] then
+    -- 锁存在，且当前是加自己的锁
+    redis.call('pexpire', KEYS[1], ARGV[2])
+    return 1
+end
+return 0
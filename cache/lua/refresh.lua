@@ -1,5 +1,5 @@
 if redis.call('get', KEYS[1]) == ARGV[1] then
-    return redis.call('EXPIRE', KEYS[1], ARGV[2])
+    return redis.call('PEXPIRE', KEYS[1], ARGV[2])
 else
     return 0
 end
\ No newline at end of file
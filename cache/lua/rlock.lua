@@ -0,0 +1,19 @@
+-- KEYS[1] 写锁 KEYS[2] 读锁集合 KEYS[3] 写锁等待标记
+-- ARGV[1] 读者唯一值 ARGV[2] 过期时间（毫秒）
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+-- 清理已经过期的读者
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+if redis.call('EXISTS', KEYS[1]) == 1 then
+    -- 写锁被人拿着
+    return 0
+end
+if redis.call('EXISTS', KEYS[3]) == 1 and redis.call('ZSCORE', KEYS[2], ARGV[1]) == false then
+    -- 写优先：有写者在排队，新的读者不能再进来
+    return 0
+end
+redis.call('ZADD', KEYS[2], now + tonumber(ARGV[2]), ARGV[1])
+-- 整个集合的过期时间跟随最晚过期的读者
+local last = redis.call('ZRANGE', KEYS[2], -1, -1, 'WITHSCORES')
+redis.call('PEXPIREAT', KEYS[2], last[2])
+return 1
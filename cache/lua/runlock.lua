@@ -0,0 +1,14 @@
+-- KEYS[1] 读锁集合
+-- ARGV[1] 读者唯一值
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score == false then
+    return 0
+end
+-- 过期的读者也顺便清理掉，但是它已经不算持有锁了
+redis.call('ZREM', KEYS[1], ARGV[1])
+if tonumber(score) <= now then
+    return 0
+end
+return 1
@@ -0,0 +1,14 @@
+-- KEYS[1] 许可集合，score 为许可的过期时间（毫秒）
+-- ARGV[1] 许可唯一值 ARGV[2] 租期（毫秒） ARGV[3] 许可总数
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+-- 回收宕机的持有者没有释放、已经过期的许可
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) == false and redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+    -- 许可已经发完了
+    return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+redis.call('PEXPIREAT', KEYS[1], last[2])
+return 1
@@ -0,0 +1,27 @@
+-- KEYS[1] 写锁 KEYS[2] 读锁集合 KEYS[3] 写锁等待标记
+-- ARGV[1] 写者唯一值 ARGV[2] 过期时间（毫秒）
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+local val = redis.call('GET', KEYS[1])
+if val == ARGV[1] then
+    -- 自己已经持有写锁
+    redis.call('PEXPIRE', KEYS[1], ARGV[2])
+    return 1
+elseif val ~= false then
+    -- 写锁被别人拿着
+    return 0
+end
+local waiting = redis.call('GET', KEYS[3])
+if waiting ~= false and waiting ~= ARGV[1] then
+    -- 别的写者排在前面
+    return 0
+end
+if redis.call('ZCARD', KEYS[2]) > 0 then
+    -- 还有读者，登记等待标记，阻止新的读者进来
+    redis.call('SET', KEYS[3], ARGV[1], 'PX', ARGV[2])
+    return 0
+end
+redis.call('DEL', KEYS[3])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// MemoryLocker 基于进程内存的 Locker 实现，主要用于单元测试
+// 行为和 redis 的实现保持一致：
+// 1. 锁会在 expiration 之后过期，过期之后别人可以拿到锁
+// 2. 只有持有者（value 一致）才能续约和释放
+// 3. 每次加锁都会拿到单调递增的 fencing token
+type MemoryLocker struct {
+	mu     sync.Mutex
+	locks  map[string]memoryLockEntry
+	tokens map[string]int64
+}
+
+type memoryLockEntry struct {
+	value    string
+	deadline time.Time
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks:  make(map[string]memoryLockEntry),
+		tokens: make(map[string]int64),
+	}
+}
+
+// Lock 支持重试上锁
+// timeout 在内存实现下没有意义，仅仅是为了和 Client.Lock 保持一致
+func (m *MemoryLocker) Lock(ctx context.Context,
+	key string,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) (*Lock, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err := checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	var timer *time.Timer
+	val := uuid.New().String()
+	retry = newRetryIterator(retry)
+	for {
+		if token := m.lock(key, val, expiration); token > 0 {
+			return m.newLock(key, val, expiration, token), nil
+		}
+		interval, ok := retry.Next()
+		if !ok {
+			return nil, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *MemoryLocker) TryLock(ctx context.Context, key string, expiration time.Duration) (*Lock, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err := checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	val := uuid.New().String()
+	token := m.lock(key, val, expiration)
+	if token == 0 {
+		return nil, ErrFailedToPreemptLock
+	}
+	return m.newLock(key, val, expiration, token), nil
+}
+
+// lock 加锁成功返回 fencing token，否则返回 0
+func (m *MemoryLocker) lock(key, val string, expiration time.Duration) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	entry, ok := m.locks[key]
+	if ok && now.Before(entry.deadline) {
+		if entry.value != val {
+			return 0
+		}
+		// 自己的锁，只续约
+		entry.deadline = now.Add(expiration)
+		m.locks[key] = entry
+		return m.tokens[key]
+	}
+	m.locks[key] = memoryLockEntry{value: val, deadline: now.Add(expiration)}
+	m.tokens[key]++
+	return m.tokens[key]
+}
+
+func (m *MemoryLocker) newLock(key, val string, expiration time.Duration, token int64) *Lock {
+	return &Lock{
+		key:             key,
+		value:           val,
+		expiration:      expiration,
+		token:           token,
+		store:           m,
+		autoRenewSwitch: make(chan struct{}, 1),
+	}
+}
+
+func (m *MemoryLocker) refresh(ctx context.Context, key, value string, expiration time.Duration) (int64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.hold(key, value)
+	if !ok {
+		return 0, nil
+	}
+	entry.deadline = time.Now().Add(expiration)
+	m.locks[key] = entry
+	return 1, nil
+}
+
+func (m *MemoryLocker) unlock(ctx context.Context, key, value string) (int64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.hold(key, value); !ok {
+		return 0, nil
+	}
+	delete(m.locks, key)
+	return 1, nil
+}
+
+// hold 判断 value 是否持有 key 对应的锁，必须在锁范围内调用
+func (m *MemoryLocker) hold(key, value string) (memoryLockEntry, bool) {
+	entry, ok := m.locks[key]
+	if !ok {
+		return entry, false
+	}
+	if !time.Now().Before(entry.deadline) {
+		// 顺便清理掉已经过期的锁
+		delete(m.locks, key)
+		return entry, false
+	}
+	return entry, entry.value == value
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryLocker_TryLock(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, m *MemoryLocker)
+
+		wantErr   error
+		wantToken int64
+	}{
+		{
+			name:      "locked",
+			before:    func(t *testing.T, m *MemoryLocker) {},
+			wantToken: 1,
+		},
+		{
+			name: "others hold lock",
+			before: func(t *testing.T, m *MemoryLocker) {
+				_, err := m.TryLock(context.Background(), "key1", time.Minute)
+				require.NoError(t, err)
+			},
+			wantErr: ErrFailedToPreemptLock,
+		},
+		{
+			// 别人的锁过期了
+			name: "others lock expired",
+			before: func(t *testing.T, m *MemoryLocker) {
+				_, err := m.TryLock(context.Background(), "key1", time.Millisecond)
+				require.NoError(t, err)
+				time.Sleep(time.Millisecond * 5)
+			},
+			wantToken: 2,
+		},
+		{
+			name: "others unlocked",
+			before: func(t *testing.T, m *MemoryLocker) {
+				l, err := m.TryLock(context.Background(), "key1", time.Minute)
+				require.NoError(t, err)
+				require.NoError(t, l.UnLock(context.Background()))
+			},
+			wantToken: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMemoryLocker()
+			tc.before(t, m)
+			l, err := m.TryLock(context.Background(), "key1", time.Minute)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantToken, l.FencingToken())
+		})
+	}
+}
+
+func TestMemoryLocker_Lock(t *testing.T) {
+	m := NewMemoryLocker()
+	l1, err := m.Lock(context.Background(), "key1", time.Millisecond*50, time.Second,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1})
+	require.NoError(t, err)
+
+	_, err = m.Lock(context.Background(), "key1", time.Minute, time.Second,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2})
+	assert.Equal(t, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock), err)
+
+	// 重试期间锁过期了
+	l2, err := m.Lock(context.Background(), "key1", time.Minute, time.Second,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond * 10, MaxCnt: 10})
+	require.NoError(t, err)
+	assert.Greater(t, l2.FencingToken(), l1.FencingToken())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = m.Lock(ctx, "key1", time.Minute, time.Second,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 100})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// ctx 已经取消的时候，锁空闲也不会加锁
+	require.NoError(t, l2.UnLock(context.Background()))
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = m.Lock(ctx, "key1", time.Minute, time.Second,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1})
+	assert.Equal(t, context.Canceled, err)
+	_, err = m.TryLock(context.Background(), "key1", time.Minute)
+	assert.NoError(t, err)
+}
+
+func TestMemoryLocker_RefreshAndUnLock(t *testing.T) {
+	m := NewMemoryLocker()
+	l, err := m.TryLock(context.Background(), "key1", time.Millisecond*20)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond * 10)
+		require.NoError(t, l.Refresh(context.Background()))
+	}
+	// 续约之后依旧持有锁
+	_, err = m.TryLock(context.Background(), "key1", time.Minute)
+	assert.Equal(t, ErrFailedToPreemptLock, err)
+
+	// 别人不能释放自己的锁
+	other := &Lock{key: "key1", value: "other", store: m}
+	assert.Equal(t, ErrLockNotHold, other.UnLock(context.Background()))
+	assert.Equal(t, ErrLockNotHold, other.Refresh(context.Background()))
+
+	require.NoError(t, l.UnLock(context.Background()))
+	assert.Equal(t, ErrLockNotHold, l.UnLock(context.Background()))
+
+	// 过期之后不能再续约
+	l, err = m.TryLock(context.Background(), "key1", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 5)
+	assert.Equal(t, ErrLockNotHold, l.Refresh(context.Background()))
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	//go:embed lua/fair_lock.lua
+	fairLockLua string
+	//go:embed lua/fair_unlock.lua
+	fairUnLockLua string
+	//go:embed lua/fair_cancel.lua
+	fairCancelLua string
+)
+
+// FairLock 公平锁，支持重试上锁
+// 和 Lock 不同的是，拿不到锁的时候会在 redis 里面排队，并且阻塞在自己的通知列表上（BLPOP）
+// 持有者释放锁的时候会直接唤醒队首的排队者，因此不需要频繁轮询，也不会在锁释放之后很久才醒过来
+// retry 返回的重试间隔只是兜底：通知丢失的时候（例如持有者宕机，锁是过期释放的），依旧会按照间隔重试
+// 注意：
+// 1. 排队者超过自己的等待时间（加上 timeout）没有再次尝试加锁，会被认为已经宕机，从而失去排队位置
+// 2. BLPOP 的超时时间最小是 1 秒，所以兜底的重试间隔会被向上取整到秒
+// 3. 只有通过 FairLock 拿到的锁，UnLock 的时候才会唤醒排队者
+func (c *Client) FairLock(ctx context.Context,
+	key string,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) (l *Lock, err error) {
+	start := time.Now()
+	retries := 0
+	defer func() {
+		c.reportAcquire(key, start, retries, err)
+	}()
+	if err = checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	val := uuid.New().String()
+	notifyKey := fairNotifyKeyPrefix(key) + val
+	keys := []string{key, fairWaitersKey(key), fairWaitersTimeoutKey(key), notifyKey, fencingKey(key)}
+	retry = newRetryIterator(retry)
+	// 先拿到这一次失败之后要等多久，排队位置的超时时间要覆盖这段等待
+	interval, ok := retry.Next()
+	for {
+		lctx, cancelFunc := context.WithTimeout(ctx, timeout)
+		token, err := c.client.Eval(lctx, fairLockLua, keys, val,
+			expiration.Milliseconds(), fairQueueTimeout(interval, ok, timeout).Milliseconds()).Int64()
+		cancelFunc()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			c.cancelFairLock(ctx, keys, val, expiration, timeout)
+			return nil, err
+		}
+
+		if token > 0 {
+			l = c.newLock(ctx, key, val, expiration, token, true)
+			return l, nil
+		}
+		if !ok {
+			c.cancelFairLock(ctx, keys, val, expiration, timeout)
+			return nil, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
+		}
+		retries++
+		// 不管是被唤醒还是超时，都要重新尝试加锁
+		err = c.client.BLPop(ctx, blockTimeout(interval), notifyKey).Err()
+		if ctx.Err() != nil {
+			c.cancelFairLock(ctx, keys, val, expiration, timeout)
+			return nil, ctx.Err()
+		}
+		if err != nil && err != redis.Nil {
+			c.cancelFairLock(ctx, keys, val, expiration, timeout)
+			return nil, err
+		}
+		interval, ok = retry.Next()
+	}
+}
+
+// cancelFairLock 放弃排队
+func (c *Client) cancelFairLock(ctx context.Context, keys []string, val string, expiration, timeout time.Duration) {
+	// 这里不能用已经取消的 ctx
+	cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	_ = c.client.Eval(cctx, fairCancelLua, keys, val,
+		fairNotifyKeyPrefix(keys[0]), expiration.Milliseconds()).Err()
+}
+
+// fairQueueTimeout 排队位置的超时时间，和锁的过期时间无关
+// 排队者在 BLPOP 上最多阻塞 blockTimeout(interval)，再加上一次加锁脚本的 timeout，
+// 超过这个时间还没有再次尝试加锁，才说明排队者已经宕机
+// 不会再重试的时候，这一次失败之后马上就会放弃排队，只需要覆盖脚本本身
+func fairQueueTimeout(interval time.Duration, retry bool, timeout time.Duration) time.Duration {
+	if !retry {
+		return timeout
+	}
+	return blockTimeout(interval) + timeout
+}
+
+// blockTimeout 将等待时间向上取整到秒，BLPOP 不支持更小的精度
+func blockTimeout(interval time.Duration) time.Duration {
+	if interval < time.Second {
+		return time.Second
+	}
+	return (interval + time.Second - 1) / time.Second * time.Second
+}
+
+// 这几个 key 都使用了 hash tag，保证在 redis cluster 下和锁本身落在同一个 slot
+
+func fairWaitersKey(key string) string {
+	return fmt.Sprintf("{%s}:waiters", key)
+}
+
+func fairWaitersTimeoutKey(key string) string {
+	return fmt.Sprintf("{%s}:waiters_timeout", key)
+}
+
+func fairNotifyKeyPrefix(key string) string {
+	return fmt.Sprintf("{%s}:notify:", key)
+}
+
+// redisFairLockStore FairLock 拿到的锁使用的 store，释放的时候需要唤醒排队者
+type redisFairLockStore struct {
+	*redisLockStore
+	expiration time.Duration
+}
+
+func (s *redisFairLockStore) unlock(ctx context.Context, key, value string) (int64, error) {
+	res, err := s.c.Eval(ctx, fairUnLockLua, []string{key, fairWaitersKey(key)},
+		value, fairNotifyKeyPrefix(key), s.expiration.Milliseconds()).Int64()
+	s.delOwner(ctx, res, err)
+	return res, err
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+func TestClient_FairLock(t *testing.T) {
+	evalRes := func(val any) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		res.SetVal(val)
+		return res
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(2000)).
+					Return(evalRes(int64(1)))
+				return cmd
+			},
+		},
+		{
+			// 排队之后被唤醒，然后拿到锁
+			name: "notified and locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(2000)).
+						Return(evalRes(int64(0))),
+					cmd.EXPECT().BLPop(gomock.Any(), time.Second, gomock.Any()).
+						Return(redis.NewStringSliceResult([]string{"{key1}:notify:xxx", "1"}, nil)),
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(1000)).
+						Return(evalRes(int64(1))),
+				)
+				return cmd
+			},
+		},
+		{
+			// 没有收到通知，依靠兜底重试拿到锁
+			name: "notification missed and locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(2000)).
+						Return(evalRes(int64(0))),
+					cmd.EXPECT().BLPop(gomock.Any(), time.Second, gomock.Any()).
+						Return(redis.NewStringSliceResult(nil, redis.Nil)),
+					cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(1000)).
+						Return(evalRes(int64(1))),
+				)
+				return cmd
+			},
+		},
+		{
+			// 超出重试次数，要放弃排队
+			name: "retry exhausted",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(2000)).
+					Return(evalRes(int64(0)))
+				cmd.EXPECT().BLPop(gomock.Any(), time.Second, gomock.Any()).
+					Return(redis.NewStringSliceResult(nil, redis.Nil))
+				cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(60000), int64(1000)).
+					Return(evalRes(int64(0)))
+				cmd.EXPECT().Eval(gomock.Any(), fairCancelLua,
+					gomock.Any(), gomock.Any(), "{key1}:notify:", int64(60000)).
+					Return(evalRes(int64(1)))
+				return cmd
+			},
+			wantErr: fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewRedisClient(tc.mock(ctrl))
+			l, err := client.FairLock(context.Background(), "key1", time.Minute, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1})
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "key1", l.key)
+			assert.IsType(t, &redisFairLockStore{}, l.store)
+			assert.Equal(t, int64(1), l.FencingToken())
+			assert.NotEmpty(t, l.value)
+		})
+	}
+}
+
+// 租期小于 1 秒的时候，排队位置不能比 BLPOP 的兜底等待先过期
+func TestClient_FairLockShortLease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	res := redis.NewCmd(context.Background())
+	res.SetVal(int64(0))
+	locked := redis.NewCmd(context.Background())
+	locked.SetVal(int64(1))
+	gomock.InOrder(
+		// 排队超时时间 = 1 秒的 BLPOP + 100 毫秒的 timeout
+		cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(500), int64(1100)).
+			Return(res),
+		cmd.EXPECT().BLPop(gomock.Any(), time.Second, gomock.Any()).
+			Return(redis.NewStringSliceResult(nil, redis.Nil)),
+		cmd.EXPECT().Eval(gomock.Any(), fairLockLua, gomock.Any(), gomock.Any(), int64(500), int64(1100)).
+			Return(locked),
+	)
+	client := NewRedisClient(cmd)
+	l, err := client.FairLock(context.Background(), "key1", time.Millisecond*500, time.Millisecond*100,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond * 200, MaxCnt: 3})
+	assert.NoError(t, err)
+	assert.IsType(t, &redisFairLockStore{}, l.store)
+}
+
+func TestFairQueueTimeout(t *testing.T) {
+	assert.Equal(t, time.Second+time.Millisecond*100, fairQueueTimeout(time.Millisecond, true, time.Millisecond*100))
+	assert.Equal(t, 3*time.Second, fairQueueTimeout(time.Second*2, true, time.Second))
+	assert.Equal(t, time.Second, fairQueueTimeout(time.Second*2, false, time.Second))
+}
+
+func TestLock_UnLockFair(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	res := redis.NewCmd(context.Background())
+	res.SetVal(int64(1))
+	cmd.EXPECT().Eval(context.Background(), fairUnLockLua, []string{"key1", "{key1}:waiters"},
+		"value1", "{key1}:notify:", int64(60000)).Return(res)
+	l := &Lock{
+		key:        "key1",
+		value:      "value1",
+		expiration: time.Minute,
+		store:      &redisFairLockStore{redisLockStore: &redisLockStore{c: cmd}, expiration: time.Minute},
+	}
+	assert.NoError(t, l.UnLock(context.Background()))
+}
+
+func TestBlockTimeout(t *testing.T) {
+	assert.Equal(t, time.Second, blockTimeout(time.Millisecond))
+	assert.Equal(t, time.Second, blockTimeout(time.Second))
+	assert.Equal(t, 2*time.Second, blockTimeout(time.Second+time.Millisecond))
+}
@@ -8,12 +8,14 @@ import (
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/sync/singleflight"
+	"sync"
 	"time"
 )
 
 var (
 	ErrFailedToPreemptLock = errors.New("redis-lock: 抢锁失败")
 	ErrLockNotHold         = errors.New("redis-lock: 你没有持有锁")
+	ErrInvalidExpiration   = errors.New("redis-lock: 过期时间不能小于 1 毫秒")
 
 	//go:embed lua/unlock.lua
 	unLockLua string
@@ -26,14 +28,21 @@ var (
 type Client struct {
 	client redis.Cmdable
 	sg     *singleflight.Group
+	// 持有者的元数据，为 nil 的时候不记录
+	ownerMeta map[string]string
+	hook      LockHook
 }
 
-func NewRedisClient(client redis.Cmdable) *Client {
+func NewRedisClient(client redis.Cmdable, opts ...ClientOption) *Client {
 	sg := singleflight.Group{}
-	return &Client{
+	c := &Client{
 		client: client,
 		sg:     &sg,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Client) SingleflightLock(ctx context.Context,
@@ -67,34 +76,92 @@ func (c *Client) SingleflightLock(ctx context.Context,
 
 // Lock 支持重试上锁
 // ctx 可以控制总共时长 key 上锁的key expiration 锁时长 timeout 重试合计超时时间 retry 重试迭代器
+// expiration 精确到毫秒，可以使用 500ms 之类的短租期
 func (c *Client) Lock(ctx context.Context,
 	key string,
 	expiration time.Duration,
 	timeout time.Duration,
-	retry RetryStrategy) (*Lock, error) {
-	var timer *time.Timer
+	retry RetryStrategy) (l *Lock, err error) {
+	start := time.Now()
+	retries := 0
+	defer func() {
+		c.reportAcquire(key, start, retries, err)
+	}()
+	if err = checkExpiration(expiration); err != nil {
+		return nil, err
+	}
 	val := uuid.New().String()
+	token, retries, err := evalWithRetry(ctx, c.client, lockLua, []string{key, fencingKey(key)},
+		[]any{val, expiration.Milliseconds()}, timeout, retry)
+	if err != nil {
+		return nil, err
+	}
+	return c.newLock(ctx, key, val, expiration, token, false), nil
+}
+
+func (c *Client) TryLock(
+	ctx context.Context,
+	key string,
+	expiration time.Duration) (l *Lock, err error) {
+	start := time.Now()
+	defer func() {
+		c.reportAcquire(key, start, 0, err)
+	}()
+	if err = checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	val := uuid.New().String()
+	token, err := c.client.Eval(ctx, lockLua, []string{key, fencingKey(key)}, val, expiration.Milliseconds()).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrFailedToPreemptLock
+	}
+	return c.newLock(ctx, key, val, expiration, token, false), nil
+}
+
+// checkExpiration 过期时间精确到毫秒，不足 1 毫秒的部分会被舍弃
+func checkExpiration(expiration time.Duration) error {
+	if expiration < time.Millisecond {
+		return ErrInvalidExpiration
+	}
+	return nil
+}
+
+// fencingKey fencing token 计数器
+// 计数器不会过期，否则 token 就不能保证单调递增
+// 使用 hash tag 保证在 redis cluster 下和锁本身落在同一个 slot
+func fencingKey(key string) string {
+	return fmt.Sprintf("{%s}:fencing", key)
+}
+
+// evalWithRetry 重复执行加锁脚本，直到脚本返回大于 0 的值，返回脚本的结果以及重试的次数
+// 脚本返回 0 表示这一次没有拿到，按照 retry 的间隔重试
+func evalWithRetry(ctx context.Context,
+	client redis.Cmdable,
+	script string,
+	keys []string,
+	args []any,
+	timeout time.Duration,
+	retry RetryStrategy) (res int64, retries int, err error) {
+	var timer *time.Timer
+	retry = newRetryIterator(retry)
 	for {
 		lctx, cancelFunc := context.WithTimeout(ctx, timeout)
-		res, err := c.client.Eval(lctx, lockLua, []string{key}, val, expiration.Seconds()).Result()
+		res, err = client.Eval(lctx, script, keys, args...).Int64()
 		cancelFunc()
 		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
-			return nil, err
+			return 0, retries, err
 		}
-
-		if res == "OK" {
-			return &Lock{
-				key:             key,
-				value:           val,
-				c:               c.client,
-				expiration:      expiration,
-				autoRenewSwitch: make(chan struct{}, 1),
-			}, nil
+		if res > 0 {
+			return res, retries, nil
 		}
 		interval, ok := retry.Next()
 		if !ok {
-			return nil, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
+			return 0, retries, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
 		}
+		retries++
 		if timer == nil {
 			timer = time.NewTimer(interval)
 		} else {
@@ -103,44 +170,68 @@ func (c *Client) Lock(ctx context.Context,
 		select {
 		case <-timer.C:
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return 0, retries, ctx.Err()
 		}
 	}
 }
 
-func (c *Client) TryLock(
-	ctx context.Context,
-	key string,
-	expiration time.Duration) (*Lock, error) {
-	val := uuid.New().String()
-	ok, err := c.client.SetNX(ctx, key, val, expiration).Result()
-	if err != nil {
-		return nil, err
-	}
-	if !ok {
-		return nil, ErrFailedToPreemptLock
-	}
-	return &Lock{
-		c:               c.client,
-		key:             key,
-		value:           val,
-		expiration:      expiration,
-		autoRenewSwitch: make(chan struct{}, 1),
-	}, nil
-}
-
 type Lock struct {
-	c          redis.Cmdable
 	key        string
 	value      string
 	expiration time.Duration
+	// 加锁的时候拿到的 fencing token
+	token int64
+	// 续约和释放都由 store 完成，不同的 Locker 实现提供不同的 store
+	store lockStore
+	// 埋点，为 nil 的时候不上报
+	hook       LockHook
+	acquiredAt time.Time
 	// 自动续期开关
 	autoRenewSwitch chan struct{}
+
+	watchDogMu sync.Mutex
+	// 停止看门狗，没有启动看门狗的时候为 nil
+	stopWatchDog context.CancelCauseFunc
+}
+
+// redisLockStore Lock 和 TryLock 拿到的锁使用的 store
+type redisLockStore struct {
+	c redis.Cmdable
+	// 持有者元数据的 key，没有开启 WithOwnerMetadata 的时候为空
+	ownerKey string
+}
+
+func (s *redisLockStore) refresh(ctx context.Context, key, value string, expiration time.Duration) (int64, error) {
+	res, err := s.c.Eval(ctx, refreshLua, []string{key}, value, expiration.Milliseconds()).Int64()
+	if err == nil && res == 1 && s.ownerKey != "" {
+		// 元数据跟着锁一起续约，失败了也不影响锁本身
+		_ = s.c.PExpire(ctx, s.ownerKey, expiration).Err()
+	}
+	return res, err
+}
+
+func (s *redisLockStore) unlock(ctx context.Context, key, value string) (int64, error) {
+	res, err := s.c.Eval(ctx, unLockLua, []string{key}, value).Int64()
+	s.delOwner(ctx, res, err)
+	return res, err
+}
+
+// delOwner 释放成功之后删除元数据
+func (s *redisLockStore) delOwner(ctx context.Context, res int64, err error) {
+	if err == nil && res == 1 && s.ownerKey != "" {
+		_ = s.c.Del(ctx, s.ownerKey).Err()
+	}
+}
+
+// FencingToken 返回加锁时拿到的 fencing token，同一个 key 上的 token 单调递增
+// 持有者可能因为 GC 之类的原因暂停，醒过来的时候锁已经过期并且被别人拿到了
+// 因此写存储的时候应该带上 token，由存储拒绝 token 比已经见过的更小的写入
+func (l *Lock) FencingToken() int64 {
+	return l.token
 }
 
 func (l *Lock) Refresh(ctx context.Context) error {
-	// 使用lua脚本
-	res, err := l.c.Eval(ctx, refreshLua, []string{l.key}, l.value, l.expiration.Seconds()).Int64()
+	res, err := l.store.refresh(ctx, l.key, l.value, l.expiration)
 	if err != nil {
 		return err
 	}
@@ -150,16 +241,18 @@ func (l *Lock) Refresh(ctx context.Context) error {
 	return nil
 }
 
-func (l *Lock) UnLock(ctx context.Context) error {
+func (l *Lock) UnLock(ctx context.Context) (err error) {
 	// 使用lua脚本
 	// 为了防止误删到其他的锁，这里我们建议使用 Lua 脚本通过 key 对应的 value（唯一值）来判断
-	res, err := l.c.Eval(ctx, unLockLua, []string{l.key}, l.value).Int64()
+	res, err := l.store.unlock(ctx, l.key, l.value)
 	defer func() {
+		l.stopWatch()
 		select {
 		case l.autoRenewSwitch <- struct{}{}:
 		default:
 			// 说明没有人调用 AutoRefresh
 		}
+		l.reportRelease(err)
 	}()
 	if err != nil {
 		return err
@@ -82,7 +82,7 @@ func TestClient_e2e_TryLock(t *testing.T) {
 			assert.Equal(t, tc.wantLock.key, lock.key)
 			assert.Equal(t, tc.wantLock.expiration, lock.expiration)
 			assert.NotEmpty(t, lock.value)
-			assert.NotNil(t, lock.c)
+			assert.NotNil(t, lock.store)
 
 		})
 	}
@@ -197,7 +197,7 @@ func TestClient_e2e_Lock(t *testing.T) {
 			assert.Equal(t, tc.wantLock.key, lock.key)
 			assert.Equal(t, tc.wantLock.expiration, lock.expiration)
 			assert.NotEmpty(t, lock.value)
-			assert.NotNil(t, lock.c)
+			assert.NotNil(t, lock.store)
 			tc.after(t)
 		})
 	}
@@ -224,7 +224,7 @@ func TestClient_e2e_Unlock(t *testing.T) {
 			lock: &Lock{
 				key:   "unlock_key1",
 				value: "123",
-				c:     rdb,
+				store: &redisLockStore{c: rdb},
 			},
 			wantErr: ErrLockNotHold,
 		},
@@ -250,7 +250,7 @@ func TestClient_e2e_Unlock(t *testing.T) {
 			lock: &Lock{
 				key:   "unlock_key2",
 				value: "123",
-				c:     rdb,
+				store: &redisLockStore{c: rdb},
 			},
 			wantErr: ErrLockNotHold,
 		},
@@ -276,7 +276,7 @@ func TestClient_e2e_Unlock(t *testing.T) {
 			lock: &Lock{
 				key:   "unlock_key3",
 				value: "123",
-				c:     rdb,
+				store: &redisLockStore{c: rdb},
 			},
 		},
 	}
@@ -314,7 +314,7 @@ func TestClient_e2e_Refresh(t *testing.T) {
 			lock: &Lock{
 				key:        "refresh_key1",
 				value:      "123",
-				c:          rdb,
+				store:      &redisLockStore{c: rdb},
 				expiration: time.Minute,
 			},
 			wantErr: ErrLockNotHold,
@@ -344,7 +344,7 @@ func TestClient_e2e_Refresh(t *testing.T) {
 			lock: &Lock{
 				key:        "refresh_key2",
 				value:      "123",
-				c:          rdb,
+				store:      &redisLockStore{c: rdb},
 				expiration: time.Minute,
 			},
 			wantErr: ErrLockNotHold,
@@ -374,7 +374,7 @@ func TestClient_e2e_Refresh(t *testing.T) {
 			lock: &Lock{
 				key:        "refresh_key3",
 				value:      "123",
-				c:          rdb,
+				store:      &redisLockStore{c: rdb},
 				expiration: time.Minute,
 			},
 		},
@@ -392,6 +392,69 @@ func TestClient_e2e_Refresh(t *testing.T) {
 	}
 }
 
+func TestClient_e2e_FencingToken(t *testing.T) {
+	rdb := getRdb()
+	client := NewRedisClient(rdb)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	defer rdb.Del(ctx, "fencing_key1", fencingKey("fencing_key1"))
+
+	l1, err := client.TryLock(ctx, "fencing_key1", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, l1.UnLock(ctx))
+	l2, err := client.TryLock(ctx, "fencing_key1", time.Minute)
+	require.NoError(t, err)
+	// 后拿到锁的 token 一定更大
+	assert.Greater(t, l2.FencingToken(), l1.FencingToken())
+	require.NoError(t, l2.UnLock(ctx))
+}
+
+func TestClient_e2e_MillisecondExpiration(t *testing.T) {
+	rdb := getRdb()
+	client := NewRedisClient(rdb)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	defer rdb.Del(ctx, "ms_key1", fencingKey("ms_key1"))
+
+	l, err := client.TryLock(ctx, "ms_key1", time.Millisecond*500)
+	require.NoError(t, err)
+	ttl, err := rdb.PTTL(ctx, "ms_key1").Result()
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Millisecond*500)
+	require.NoError(t, l.Refresh(ctx))
+	// 租期到了之后别人可以拿到锁
+	time.Sleep(time.Millisecond * 600)
+	_, err = client.TryLock(ctx, "ms_key1", time.Millisecond*500)
+	require.NoError(t, err)
+}
+
+func TestClient_e2e_LockInfo(t *testing.T) {
+	rdb := getRdb()
+	client := NewRedisClient(rdb, WithOwnerMetadata(map[string]string{"service": "order"}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	defer rdb.Del(ctx, "info_key1", fencingKey("info_key1"))
+
+	_, err := client.LockInfo(ctx, "info_key1")
+	assert.Equal(t, ErrLockNotExist, err)
+
+	l, err := client.TryLock(ctx, "info_key1", time.Minute)
+	require.NoError(t, err)
+	info, err := client.LockInfo(ctx, "info_key1")
+	require.NoError(t, err)
+	assert.Equal(t, l.value, info.Owner)
+	assert.True(t, info.TTL > 0 && info.TTL <= time.Minute)
+	assert.Equal(t, "order", info.Metadata["service"])
+	assert.NotEmpty(t, info.Metadata["pid"])
+	assert.NotEmpty(t, info.Metadata["acquired_at"])
+
+	// 释放之后元数据也被删除
+	require.NoError(t, l.UnLock(ctx))
+	n, err := rdb.Exists(ctx, ownerKeyPrefix("info_key1")+l.value).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
 func getRdb() *redis.Client {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: "192.168.31.165:6379",
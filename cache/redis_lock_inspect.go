@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrLockNotExist = errors.New("redis-lock: 锁不存在")
+
+	//go:embed lua/lock_info.lua
+	lockInfoLua string
+	//go:embed lua/owner_save.lua
+	ownerSaveLua string
+)
+
+type ClientOption func(c *Client)
+
+// WithOwnerMetadata 加锁成功之后记录持有者的元数据，可以通过 Client.LockInfo 查看
+// 默认记录 host、pid 和 acquired_at（毫秒时间戳），extra 里面的字段会一起记录，同名的时候覆盖默认字段
+// 元数据和锁的过期时间保持一致，续约的时候一起续约，释放的时候一起删除
+// 注意：元数据是加锁成功之后单独写入的，写入失败不会影响加锁的结果
+func WithOwnerMetadata(extra map[string]string) ClientOption {
+	return func(c *Client) {
+		host, _ := os.Hostname()
+		meta := map[string]string{
+			"host": host,
+			"pid":  strconv.Itoa(os.Getpid()),
+		}
+		for k, v := range extra {
+			meta[k] = v
+		}
+		c.ownerMeta = meta
+	}
+}
+
+// WithLockHook 设置埋点，只对 Client.Lock、Client.TryLock 和 Client.FairLock 生效
+func WithLockHook(hook LockHook) ClientOption {
+	return func(c *Client) {
+		c.hook = hook
+	}
+}
+
+// LockHook 锁的埋点，可以用来统计加锁耗时、重试次数、失败次数和持有时长
+// 回调是同步执行的，不要在里面做耗时的操作
+type LockHook interface {
+	// OnAcquire 加锁结束的时候调用，不管成功还是失败
+	OnAcquire(key string, stat AcquireStat)
+	// OnRelease UnLock 结束的时候调用，不管成功还是失败
+	OnRelease(key string, stat ReleaseStat)
+}
+
+type AcquireStat struct {
+	// 加锁的总耗时，包括重试的等待时间
+	Latency time.Duration
+	// 重试的次数，第一次就拿到锁的时候为 0
+	Retries int
+	// 加锁失败的原因，成功的时候为 nil
+	Err error
+}
+
+type ReleaseStat struct {
+	// 从拿到锁到释放锁的时长
+	Hold time.Duration
+	// 释放失败的原因，成功的时候为 nil
+	Err error
+}
+
+// LockInfo 锁的当前状态
+type LockInfo struct {
+	Key string
+	// 持有者的唯一值
+	Owner string
+	// 剩余的过期时间
+	TTL time.Duration
+	// 持有者的元数据，持有者没有开启 WithOwnerMetadata 的时候为空
+	Metadata map[string]string
+}
+
+// LockInfo 查看锁的持有者和剩余过期时间，锁不存在的时候返回 ErrLockNotExist
+// 只适用于 Lock、TryLock 和 FairLock 拿到的锁
+// 元数据的 key 依赖持有者的唯一值，所以分两次查询：先拿到持有者，再读取它的元数据
+// 两次查询之间锁被释放的话，返回的依旧是第一次查询时的持有者，元数据可能为空
+func (c *Client) LockInfo(ctx context.Context, key string) (LockInfo, error) {
+	res, err := c.client.Eval(ctx, lockInfoLua, []string{key}).Slice()
+	if err != nil {
+		return LockInfo{}, err
+	}
+	if len(res) == 0 {
+		return LockInfo{}, ErrLockNotExist
+	}
+	if len(res) != 2 {
+		return LockInfo{}, fmt.Errorf("redis-lock: 非法的返回值 %v", res)
+	}
+	owner, _ := res[0].(string)
+	ttl, _ := res[1].(int64)
+	meta, err := c.client.HGetAll(ctx, ownerKeyPrefix(key)+owner).Result()
+	if err != nil {
+		return LockInfo{}, err
+	}
+	return LockInfo{
+		Key:      key,
+		Owner:    owner,
+		TTL:      time.Duration(ttl) * time.Millisecond,
+		Metadata: meta,
+	}, nil
+}
+
+// ownerKeyPrefix 持有者元数据的 key 前缀，后面跟上持有者的唯一值
+// 按照唯一值区分，避免过期之后释放的时候删掉下一个持有者的元数据
+func ownerKeyPrefix(key string) string {
+	return fmt.Sprintf("{%s}:owner:", key)
+}
+
+// newLock 加锁成功之后创建 Lock，开启了 WithOwnerMetadata 的时候会写入元数据
+// fair 表示是否是通过 FairLock 拿到的锁
+func (c *Client) newLock(ctx context.Context, key, val string, expiration time.Duration, token int64, fair bool) *Lock {
+	store := &redisLockStore{c: c.client}
+	l := &Lock{
+		key:             key,
+		value:           val,
+		expiration:      expiration,
+		token:           token,
+		hook:            c.hook,
+		acquiredAt:      time.Now(),
+		autoRenewSwitch: make(chan struct{}, 1),
+	}
+	if c.ownerMeta != nil {
+		store.ownerKey = ownerKeyPrefix(key) + val
+		args := make([]any, 0, len(c.ownerMeta)*2+3)
+		args = append(args, expiration.Milliseconds(), "acquired_at", l.acquiredAt.UnixMilli())
+		for k, v := range c.ownerMeta {
+			args = append(args, k, v)
+		}
+		// 元数据只是辅助信息，失败了也不影响锁本身
+		_ = c.client.Eval(ctx, ownerSaveLua, []string{store.ownerKey}, args...).Err()
+	}
+	l.store = store
+	if fair {
+		l.store = &redisFairLockStore{redisLockStore: store, expiration: expiration}
+	}
+	return l
+}
+
+func (c *Client) reportAcquire(key string, start time.Time, retries int, err error) {
+	if c.hook == nil {
+		return
+	}
+	c.hook.OnAcquire(key, AcquireStat{
+		Latency: time.Since(start),
+		Retries: retries,
+		Err:     err,
+	})
+}
+
+func (l *Lock) reportRelease(err error) {
+	if l.hook == nil {
+		return
+	}
+	l.hook.OnRelease(l.key, ReleaseStat{
+		Hold: time.Since(l.acquiredAt),
+		Err:  err,
+	})
+}
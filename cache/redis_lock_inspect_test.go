@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go_utils/cache/mocks"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClient_LockInfo(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr  error
+		wantInfo LockInfo
+	}{
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(gomock.Any(), lockInfoLua, []string{"key1"}).
+					Return(res)
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "not exist",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{})
+				cmd.EXPECT().Eval(gomock.Any(), lockInfoLua, []string{"key1"}).
+					Return(res)
+				return cmd
+			},
+			wantErr: ErrLockNotExist,
+		},
+		{
+			name: "metadata error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{"value1", int64(60000)})
+				cmd.EXPECT().Eval(gomock.Any(), lockInfoLua, []string{"key1"}).
+					Return(res)
+				cmd.EXPECT().HGetAll(gomock.Any(), "{key1}:owner:value1").
+					Return(redis.NewMapStringStringResult(nil, context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "without metadata",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{"value1", int64(1500)})
+				cmd.EXPECT().Eval(gomock.Any(), lockInfoLua, []string{"key1"}).
+					Return(res)
+				cmd.EXPECT().HGetAll(gomock.Any(), "{key1}:owner:value1").
+					Return(redis.NewMapStringStringResult(map[string]string{}, nil))
+				return cmd
+			},
+			wantInfo: LockInfo{
+				Key:      "key1",
+				Owner:    "value1",
+				TTL:      time.Millisecond * 1500,
+				Metadata: map[string]string{},
+			},
+		},
+		{
+			name: "with metadata",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal([]any{"value1", int64(60000)})
+				cmd.EXPECT().Eval(gomock.Any(), lockInfoLua, []string{"key1"}).
+					Return(res)
+				cmd.EXPECT().HGetAll(gomock.Any(), "{key1}:owner:value1").
+					Return(redis.NewMapStringStringResult(map[string]string{"host": "host1", "pid": "123"}, nil))
+				return cmd
+			},
+			wantInfo: LockInfo{
+				Key:      "key1",
+				Owner:    "value1",
+				TTL:      time.Minute,
+				Metadata: map[string]string{"host": "host1", "pid": "123"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewRedisClient(tc.mock(ctrl))
+			info, err := client.LockInfo(context.Background(), "key1")
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantInfo, info)
+		})
+	}
+}
+
+func TestClient_OwnerMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+
+	lockRes := redis.NewCmd(context.Background())
+	lockRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+		Return(lockRes)
+	var ownerKey string
+	var ownerArgs []any
+	saveRes := redis.NewCmd(context.Background())
+	saveRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), ownerSaveLua, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+			ownerKey = keys[0]
+			ownerArgs = args
+			return saveRes
+		})
+
+	client := NewRedisClient(cmd, WithOwnerMetadata(map[string]string{"service": "order"}))
+	l, err := client.TryLock(context.Background(), "key1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "{key1}:owner:"+l.value, ownerKey)
+	require.True(t, len(ownerArgs)%2 == 1)
+	assert.Equal(t, int64(60000), ownerArgs[0])
+	meta := make(map[string]any, len(ownerArgs)/2)
+	for i := 1; i < len(ownerArgs); i += 2 {
+		meta[ownerArgs[i].(string)] = ownerArgs[i+1]
+	}
+	host, _ := os.Hostname()
+	assert.Equal(t, host, meta["host"])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), meta["pid"])
+	assert.Equal(t, "order", meta["service"])
+	assert.Contains(t, meta, "acquired_at")
+
+	// 续约和释放的时候，元数据跟着一起处理
+	refreshRes := redis.NewCmd(context.Background())
+	refreshRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), refreshLua, []string{"key1"}, l.value, int64(60000)).
+		Return(refreshRes)
+	pexpireRes := redis.NewBoolCmd(context.Background())
+	pexpireRes.SetVal(true)
+	cmd.EXPECT().PExpire(gomock.Any(), ownerKey, time.Minute).Return(pexpireRes)
+	require.NoError(t, l.Refresh(context.Background()))
+
+	unlockRes := redis.NewCmd(context.Background())
+	unlockRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, l.value).Return(unlockRes)
+	delRes := redis.NewIntCmd(context.Background())
+	delRes.SetVal(1)
+	cmd.EXPECT().Del(gomock.Any(), ownerKey).Return(delRes)
+	require.NoError(t, l.UnLock(context.Background()))
+}
+
+type mockLockHook struct {
+	acquires map[string][]AcquireStat
+	releases map[string][]ReleaseStat
+}
+
+func newMockLockHook() *mockLockHook {
+	return &mockLockHook{
+		acquires: make(map[string][]AcquireStat),
+		releases: make(map[string][]ReleaseStat),
+	}
+}
+
+func (m *mockLockHook) OnAcquire(key string, stat AcquireStat) {
+	m.acquires[key] = append(m.acquires[key], stat)
+}
+
+func (m *mockLockHook) OnRelease(key string, stat ReleaseStat) {
+	m.releases[key] = append(m.releases[key], stat)
+}
+
+func TestClient_LockHook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	hook := newMockLockHook()
+	client := NewRedisClient(cmd, WithLockHook(hook))
+
+	// 重试两次之后拿到锁
+	failRes := redis.NewCmd(context.Background())
+	failRes.SetVal(int64(0))
+	lockRes := redis.NewCmd(context.Background())
+	lockRes.SetVal(int64(1))
+	gomock.InOrder(
+		cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+			Times(2).Return(failRes),
+		cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+			Return(lockRes),
+	)
+	l, err := client.Lock(context.Background(), "key1", time.Minute, time.Second,
+		&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3})
+	require.NoError(t, err)
+	require.Len(t, hook.acquires["key1"], 1)
+	stat := hook.acquires["key1"][0]
+	assert.Equal(t, 2, stat.Retries)
+	assert.NoError(t, stat.Err)
+	assert.Greater(t, stat.Latency, time.Duration(0))
+
+	time.Sleep(time.Millisecond * 10)
+	unlockRes := redis.NewCmd(context.Background())
+	unlockRes.SetVal(int64(0))
+	cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, l.value).Return(unlockRes)
+	assert.Equal(t, ErrLockNotHold, l.UnLock(context.Background()))
+	require.Len(t, hook.releases["key1"], 1)
+	assert.Equal(t, ErrLockNotHold, hook.releases["key1"][0].Err)
+	assert.GreaterOrEqual(t, hook.releases["key1"][0].Hold, time.Millisecond*10)
+
+	// 加锁失败也要上报
+	cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key2", "{key2}:fencing"}, gomock.Any(), int64(60000)).
+		Return(failRes)
+	_, err = client.TryLock(context.Background(), "key2", time.Minute)
+	assert.Equal(t, ErrFailedToPreemptLock, err)
+	require.Len(t, hook.acquires["key2"], 1)
+	assert.True(t, errors.Is(hook.acquires["key2"][0].Err, ErrFailedToPreemptLock))
+	assert.Equal(t, 0, hook.acquires["key2"][0].Retries)
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrLockLost = errors.New("redis-lock: 锁已经丢失")
+
+// WatchDog 启动看门狗，在后台按照 interval 续约
+// 返回的 context 会在以下情况被取消，业务代码应该监听它并且尽快中止：
+// 1. 续约的时候发现锁已经不是自己的了，context.Cause 为 ErrLockLost
+// 2. 续约持续失败（例如网络抖动），距离上一次成功续约已经超过 grace，context.Cause 同样为 ErrLockLost
+// 3. 调用了 UnLock，或者 ctx 本身被取消
+// grace 应该小于 expiration，这样业务代码可以在锁真正过期之前停下来
+// 同一把锁重复调用，会停止之前的看门狗
+func (l *Lock) WatchDog(ctx context.Context, interval, timeout, grace time.Duration) context.Context {
+	wctx, cancel := context.WithCancelCause(ctx)
+	l.watchDogMu.Lock()
+	if l.stopWatchDog != nil {
+		l.stopWatchDog(nil)
+	}
+	l.stopWatchDog = cancel
+	l.watchDogMu.Unlock()
+	go l.watch(wctx, cancel, interval, timeout, grace)
+	return wctx
+}
+
+func (l *Lock) watch(ctx context.Context,
+	cancel context.CancelCauseFunc,
+	interval, timeout, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastRefresh := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rctx, rcancel := context.WithTimeout(ctx, timeout)
+			err := l.Refresh(rctx)
+			rcancel()
+			if ctx.Err() != nil {
+				// 续约期间被 UnLock 或者外部取消了
+				return
+			}
+			switch {
+			case err == nil:
+				lastRefresh = time.Now()
+			case errors.Is(err, ErrLockNotHold):
+				cancel(ErrLockLost)
+				return
+			case time.Since(lastRefresh) >= grace:
+				cancel(fmt.Errorf("%w, 续约持续失败: %w", ErrLockLost, err))
+				return
+			}
+		}
+	}
+}
+
+// stopWatch 停止看门狗，没有启动的时候什么也不做
+func (l *Lock) stopWatch() {
+	l.watchDogMu.Lock()
+	defer l.watchDogMu.Unlock()
+	if l.stopWatchDog != nil {
+		l.stopWatchDog(nil)
+		l.stopWatchDog = nil
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+func TestLock_WatchDog(t *testing.T) {
+	evalRes := func(val int64, err error) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		if err != nil {
+			res.SetErr(err)
+		} else {
+			res.SetVal(val)
+		}
+		return res
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+		// 启动看门狗之后做什么
+		after func(t *testing.T, l *Lock, ctx context.Context)
+
+		wantCause error
+	}{
+		{
+			name: "lock lost",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), refreshLua, []string{"key1"}, "value1", int64(60000)).
+						Return(evalRes(1, nil)),
+					cmd.EXPECT().Eval(gomock.Any(), refreshLua, []string{"key1"}, "value1", int64(60000)).
+						Return(evalRes(0, nil)),
+				)
+				return cmd
+			},
+			after: func(t *testing.T, l *Lock, ctx context.Context) {
+				<-ctx.Done()
+			},
+			wantCause: ErrLockLost,
+		},
+		{
+			// 续约一直超时，超过 grace 之后认为锁已经丢失
+			name: "refresh keeps failing",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), refreshLua, []string{"key1"}, "value1", int64(60000)).
+					MinTimes(1).Return(evalRes(0, context.DeadlineExceeded))
+				return cmd
+			},
+			after: func(t *testing.T, l *Lock, ctx context.Context) {
+				<-ctx.Done()
+			},
+			wantCause: ErrLockLost,
+		},
+		{
+			name: "unlock",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), refreshLua, []string{"key1"}, "value1", int64(60000)).
+					AnyTimes().Return(evalRes(1, nil))
+				cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, "value1").
+					Return(evalRes(1, nil))
+				return cmd
+			},
+			after: func(t *testing.T, l *Lock, ctx context.Context) {
+				time.Sleep(time.Millisecond * 50)
+				assert.NoError(t, ctx.Err())
+				assert.NoError(t, l.UnLock(context.Background()))
+				<-ctx.Done()
+			},
+			wantCause: context.Canceled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			l := &Lock{
+				store:      &redisLockStore{c: tc.mock(ctrl)},
+				key:        "key1",
+				value:      "value1",
+				expiration: time.Minute,
+			}
+			ctx := l.WatchDog(context.Background(), time.Millisecond*10, time.Second, time.Millisecond*15)
+			tc.after(t, l, ctx)
+			assert.ErrorIs(t, context.Cause(ctx), tc.wantCause)
+			// 等待后台的 goroutine 退出，避免 ctrl.Finish 之后还有调用
+			time.Sleep(time.Millisecond * 20)
+		})
+	}
+}
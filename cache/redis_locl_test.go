@@ -24,11 +24,12 @@ func TestClient_TryLock(t *testing.T) {
 		wantLock *Lock
 	}{
 		{
-			name: "set nx error",
+			name: "eval error",
 			mock: func(ctrl *gomock.Controller) redis.Cmdable {
 				cmd := mocks.NewMockCmdable(ctrl)
-				res := redis.NewBoolResult(false, context.DeadlineExceeded)
-				cmd.EXPECT().SetNX(context.Background(), "key1", gomock.Any(), time.Minute).
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(context.Background(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
 					Return(res)
 				return cmd
 			},
@@ -39,8 +40,9 @@ func TestClient_TryLock(t *testing.T) {
 			name: "FailedToPreemptLock",
 			mock: func(ctrl *gomock.Controller) redis.Cmdable {
 				cmd := mocks.NewMockCmdable(ctrl)
-				res := redis.NewBoolResult(false, nil)
-				cmd.EXPECT().SetNX(context.Background(), "key1", gomock.Any(), time.Minute).
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(context.Background(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
 					Return(res)
 				return cmd
 			},
@@ -51,14 +53,16 @@ func TestClient_TryLock(t *testing.T) {
 			name: "lock",
 			mock: func(ctrl *gomock.Controller) redis.Cmdable {
 				cmd := mocks.NewMockCmdable(ctrl)
-				res := redis.NewBoolResult(true, nil)
-				cmd.EXPECT().SetNX(context.Background(), "key1", gomock.Any(), time.Minute).
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(12))
+				cmd.EXPECT().Eval(context.Background(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
 					Return(res)
 				return cmd
 			},
 			key: "key1",
 			wantLock: &Lock{
-				key: "key1",
+				key:   "key1",
+				token: 12,
 			},
 		},
 	}
@@ -74,11 +78,112 @@ func TestClient_TryLock(t *testing.T) {
 				return
 			}
 			assert.Equal(t, tc.wantLock.key, tc.key)
+			assert.Equal(t, tc.wantLock.token, lock.FencingToken())
 			assert.NotEmpty(t, lock.value)
 		})
 	}
 }
 
+func TestClient_Lock(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr   error
+		wantToken int64
+	}{
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(redis.ErrClosed)
+				cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+					Return(res)
+				return cmd
+			},
+			wantErr: redis.ErrClosed,
+		},
+		{
+			// 别人释放之后拿到锁，token 比别人的更大
+			name: "retry and locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				first := redis.NewCmd(context.Background())
+				first.SetVal(int64(0))
+				second := redis.NewCmd(context.Background())
+				second.SetVal(int64(8))
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+						Return(first),
+					cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+						Return(second),
+				)
+				return cmd
+			},
+			wantToken: 8,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewRedisClient(tc.mock(ctrl))
+			lock, err := client.Lock(context.Background(), "key1", time.Minute, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3})
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantToken, lock.FencingToken())
+		})
+	}
+}
+
+func TestClient_LockExpiration(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mock       func(ctrl *gomock.Controller) redis.Cmdable
+		expiration time.Duration
+
+		wantErr error
+	}{
+		{
+			name: "invalid expiration",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mocks.NewMockCmdable(ctrl)
+			},
+			expiration: time.Microsecond,
+			wantErr:    ErrInvalidExpiration,
+		},
+		{
+			// 不足一秒的过期时间，精确到毫秒传给 redis
+			name: "sub-second expiration",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(500)).
+					Return(res)
+				return cmd
+			},
+			expiration: time.Millisecond * 500,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewRedisClient(tc.mock(ctrl))
+			_, err := client.Lock(context.Background(), "key1", tc.expiration, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1})
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
 func TestLock_Unlock(t *testing.T) {
 	//ctrl := gomock.NewController(t)
 	//defer ctrl.Finish()
@@ -151,7 +256,7 @@ func TestLock_Unlock(t *testing.T) {
 			lock := &Lock{
 				key:   tc.key,
 				value: tc.value,
-				c:     tc.mock(ctrl),
+				store: &redisLockStore{c: tc.mock(ctrl)},
 			}
 			err := lock.UnLock(context.Background())
 			assert.Equal(t, tc.wantErr, err)
@@ -180,7 +285,7 @@ func TestLock_Refresh(t *testing.T) {
 				cmd := mocks.NewMockCmdable(ctrl)
 				res := redis.NewCmd(context.Background())
 				res.SetErr(context.DeadlineExceeded)
-				cmd.EXPECT().Eval(context.Background(), refreshLua, []string{"key1"}, "value1", float64(60)).
+				cmd.EXPECT().Eval(context.Background(), refreshLua, []string{"key1"}, "value1", int64(60000)).
 					Return(res)
 				return cmd
 			},
@@ -195,7 +300,7 @@ func TestLock_Refresh(t *testing.T) {
 				cmd := mocks.NewMockCmdable(ctrl)
 				res := redis.NewCmd(context.Background())
 				res.SetVal(int64(0))
-				cmd.EXPECT().Eval(context.Background(), refreshLua, []string{"key1"}, "value1", float64(60)).
+				cmd.EXPECT().Eval(context.Background(), refreshLua, []string{"key1"}, "value1", int64(60000)).
 					Return(res)
 				return cmd
 			},
@@ -210,7 +315,7 @@ func TestLock_Refresh(t *testing.T) {
 				cmd := mocks.NewMockCmdable(ctrl)
 				res := redis.NewCmd(context.Background())
 				res.SetVal(int64(1))
-				cmd.EXPECT().Eval(context.Background(), refreshLua, []string{"key1"}, "value1", float64(60)).
+				cmd.EXPECT().Eval(context.Background(), refreshLua, []string{"key1"}, "value1", int64(60000)).
 					Return(res)
 				return cmd
 			},
@@ -227,7 +332,7 @@ func TestLock_Refresh(t *testing.T) {
 			lock := &Lock{
 				key:        tc.key,
 				value:      tc.value,
-				c:          tc.mock(ctrl),
+				store:      &redisLockStore{c: tc.mock(ctrl)},
 				expiration: tc.expiration,
 			}
 			err := lock.Refresh(context.Background())
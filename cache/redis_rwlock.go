@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	//go:embed lua/rlock.lua
+	rLockLua string
+	//go:embed lua/rrefresh.lua
+	rRefreshLua string
+	//go:embed lua/runlock.lua
+	rUnLockLua string
+	//go:embed lua/wlock.lua
+	wLockLua string
+)
+
+// RWLock 分布式读写锁
+// 读锁可以被多个读者同时持有，每个读者有自己独立的过期时间
+// 写锁是排他的，并且写优先：写者在等待读者退出期间，新的读者无法加锁，避免写者饥饿
+type RWLock struct {
+	client redis.Cmdable
+	key    string
+	// 写锁
+	writerKey string
+	// 读者集合，score 为读者的过期时间（毫秒）
+	readersKey string
+	// 写者等待标记
+	waitingKey string
+}
+
+// RWLock 创建一个分布式读写锁
+// 这里使用了 hash tag，保证在 redis cluster 下几个 key 落在同一个 slot
+func (c *Client) RWLock(key string) *RWLock {
+	return &RWLock{
+		client:     c.client,
+		key:        key,
+		writerKey:  fmt.Sprintf("{%s}:writer", key),
+		readersKey: fmt.Sprintf("{%s}:readers", key),
+		waitingKey: fmt.Sprintf("{%s}:writer_waiting", key),
+	}
+}
+
+// RLock 加读锁，支持重试
+// 参数的含义和 Client.Lock 保持一致
+func (rw *RWLock) RLock(ctx context.Context,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) (*ReadLock, error) {
+	val := uuid.New().String()
+	err := rw.acquire(ctx, rLockLua, val, expiration, timeout, retry)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadLock{
+		c:          rw.client,
+		key:        rw.readersKey,
+		value:      val,
+		expiration: expiration,
+	}, nil
+}
+
+// Lock 加写锁，支持重试
+// 如果因为还有读者而没能拿到锁，会登记等待标记，阻止新的读者加锁
+// 最终放弃加锁的时候，会清理掉自己的等待标记
+func (rw *RWLock) Lock(ctx context.Context,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) (*WriteLock, error) {
+	val := uuid.New().String()
+	err := rw.acquire(ctx, wLockLua, val, expiration, timeout, retry)
+	if err != nil {
+		// 这里不能用已经取消的 ctx
+		cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		_ = rw.client.Eval(cctx, unLockLua, []string{rw.waitingKey}, val).Err()
+		return nil, err
+	}
+	return &WriteLock{
+		c:          rw.client,
+		key:        rw.writerKey,
+		value:      val,
+		expiration: expiration,
+	}, nil
+}
+
+func (rw *RWLock) acquire(ctx context.Context,
+	script string,
+	val string,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) error {
+	if err := checkExpiration(expiration); err != nil {
+		return err
+	}
+	keys := []string{rw.writerKey, rw.readersKey, rw.waitingKey}
+	_, _, err := evalWithRetry(ctx, rw.client, script, keys, []any{val, expiration.Milliseconds()}, timeout, retry)
+	return err
+}
+
+// ReadLock 已经持有的读锁
+type ReadLock struct {
+	c          redis.Cmdable
+	key        string
+	value      string
+	expiration time.Duration
+}
+
+// Refresh 续约读锁，只会影响自己的过期时间
+func (l *ReadLock) Refresh(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, rRefreshLua, []string{l.key}, l.value, l.expiration.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// UnLock 释放读锁，读锁已经过期的时候返回 ErrLockNotHold，和 Refresh 保持一致
+func (l *ReadLock) UnLock(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, rUnLockLua, []string{l.key}, l.value).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// WriteLock 已经持有的写锁
+type WriteLock struct {
+	c          redis.Cmdable
+	key        string
+	value      string
+	expiration time.Duration
+}
+
+// Refresh 续约写锁
+func (l *WriteLock) Refresh(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, refreshLua, []string{l.key}, l.value, l.expiration.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// UnLock 释放写锁
+func (l *WriteLock) UnLock(ctx context.Context) error {
+	res, err := l.c.Eval(ctx, unLockLua, []string{l.key}, l.value).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
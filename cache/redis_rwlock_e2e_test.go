@@ -0,0 +1,61 @@
+//go:build e2e
+
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRWLock_e2e(t *testing.T) {
+	rdb := getRdb()
+	client := NewRedisClient(rdb)
+	rw := client.RWLock("rw_key1")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	defer rdb.Del(ctx, rw.writerKey, rw.readersKey, rw.waitingKey)
+	retry := func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Millisecond * 100, MaxCnt: 2}
+	}
+
+	// 多个读者可以同时持有
+	r1, err := rw.RLock(ctx, time.Minute, time.Second, retry())
+	require.NoError(t, err)
+	r2, err := rw.RLock(ctx, time.Minute, time.Second, retry())
+	require.NoError(t, err)
+	cnt, err := rdb.ZCard(ctx, rw.readersKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	// 有读者的时候拿不到写锁，但是会登记等待标记
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		// 写者在等待，新的读者进不来
+		_, rErr := rw.RLock(ctx, time.Minute, time.Second, retry())
+		assert.ErrorIs(t, rErr, ErrFailedToPreemptLock)
+		assert.NoError(t, r1.UnLock(ctx))
+		assert.NoError(t, r2.UnLock(ctx))
+	}()
+	w, err := rw.Lock(ctx, time.Minute, time.Second, &FixedIntervalRetryStrategy{Interval: time.Millisecond * 100, MaxCnt: 100})
+	require.NoError(t, err)
+	require.NoError(t, w.Refresh(ctx))
+	require.NoError(t, w.UnLock(ctx))
+
+	// 写锁释放之后，读者可以重新进来
+	r3, err := rw.RLock(ctx, time.Minute, time.Second, retry())
+	require.NoError(t, err)
+	require.NoError(t, r3.Refresh(ctx))
+	require.NoError(t, r3.UnLock(ctx))
+
+	// 读锁过期之后，即使还没有被清理，也不能再释放
+	r4, err := rw.RLock(ctx, time.Minute, time.Second, retry())
+	require.NoError(t, err)
+	r5, err := rw.RLock(ctx, time.Millisecond*50, time.Second, retry())
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, ErrLockNotHold, r5.UnLock(ctx))
+	require.NoError(t, r4.UnLock(ctx))
+}
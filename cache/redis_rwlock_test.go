@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+var rwKeys = []string{"{key1}:writer", "{key1}:readers", "{key1}:writer_waiting"}
+
+func TestRWLock_RLock(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(redis.ErrClosed)
+				cmd.EXPECT().Eval(gomock.Any(), rLockLua, rwKeys, gomock.Any(), int64(60000)).
+					Return(res)
+				return cmd
+			},
+			wantErr: redis.ErrClosed,
+		},
+		{
+			name: "locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), rLockLua, rwKeys, gomock.Any(), int64(60000)).
+					Return(res)
+				return cmd
+			},
+		},
+		{
+			name: "retry and locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				first := redis.NewCmd(context.Background())
+				first.SetVal(int64(0))
+				second := redis.NewCmd(context.Background())
+				second.SetVal(int64(1))
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), rLockLua, rwKeys, gomock.Any(), int64(60000)).
+						Return(first),
+					cmd.EXPECT().Eval(gomock.Any(), rLockLua, rwKeys, gomock.Any(), int64(60000)).
+						Return(second),
+				)
+				return cmd
+			},
+		},
+		{
+			name: "writer hold lock",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(gomock.Any(), rLockLua, rwKeys, gomock.Any(), int64(60000)).
+					Times(3).Return(res)
+				return cmd
+			},
+			wantErr: fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewRedisClient(tc.mock(ctrl))
+			l, err := client.RWLock("key1").RLock(context.Background(), time.Minute, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2})
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "{key1}:readers", l.key)
+			assert.NotEmpty(t, l.value)
+		})
+	}
+}
+
+func TestRWLock_Lock(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "locked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), wLockLua, rwKeys, gomock.Any(), int64(60000)).
+					Return(res)
+				return cmd
+			},
+		},
+		{
+			// 放弃加锁的时候要清理等待标记
+			name: "readers hold lock",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(gomock.Any(), wLockLua, rwKeys, gomock.Any(), int64(60000)).
+					Times(3).Return(res)
+				cancelRes := redis.NewCmd(context.Background())
+				cancelRes.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"{key1}:writer_waiting"}, gomock.Any()).
+					Return(cancelRes)
+				return cmd
+			},
+			wantErr: fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := NewRedisClient(tc.mock(ctrl))
+			l, err := client.RWLock("key1").Lock(context.Background(), time.Minute, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2})
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "{key1}:writer", l.key)
+			assert.NotEmpty(t, l.value)
+		})
+	}
+}
+
+func TestReadLock_Refresh(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "lock not hold",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(context.Background(), rRefreshLua, []string{"{key1}:readers"}, "value1", int64(60000)).
+					Return(res)
+				return cmd
+			},
+			wantErr: ErrLockNotHold,
+		},
+		{
+			name: "refreshed",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(context.Background(), rRefreshLua, []string{"{key1}:readers"}, "value1", int64(60000)).
+					Return(res)
+				return cmd
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			l := &ReadLock{
+				c:          tc.mock(ctrl),
+				key:        "{key1}:readers",
+				value:      "value1",
+				expiration: time.Minute,
+			}
+			err := l.Refresh(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestReadLock_UnLock(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(context.Background(), rUnLockLua, []string{"{key1}:readers"}, "value1").
+					Return(res)
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			// 不存在或者已经过期
+			name: "lock not hold",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(context.Background(), rUnLockLua, []string{"{key1}:readers"}, "value1").
+					Return(res)
+				return cmd
+			},
+			wantErr: ErrLockNotHold,
+		},
+		{
+			name: "unlocked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(context.Background(), rUnLockLua, []string{"{key1}:readers"}, "value1").
+					Return(res)
+				return cmd
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			l := &ReadLock{
+				c:     tc.mock(ctrl),
+				key:   "{key1}:readers",
+				value: "value1",
+			}
+			err := l.UnLock(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	ErrInvalidPermits = errors.New("redis-lock: 许可数量必须大于 0")
+
+	//go:embed lua/semaphore_acquire.lua
+	semaphoreAcquireLua string
+)
+
+// Semaphore 分布式信号量，最多同时发出 permits 个许可
+// 每个许可都有自己的租期，持有者宕机之后，许可会在租期到了之后被回收
+type Semaphore struct {
+	client  redis.Cmdable
+	key     string
+	permits int
+}
+
+// Semaphore 创建一个分布式信号量
+// 所有使用同一个 key 的调用方，必须使用相同的 permits
+func (c *Client) Semaphore(key string, permits int) (*Semaphore, error) {
+	if permits <= 0 {
+		return nil, ErrInvalidPermits
+	}
+	return &Semaphore{
+		client:  c.client,
+		key:     key,
+		permits: permits,
+	}, nil
+}
+
+// Acquire 获取一个许可，支持重试
+// 参数的含义和 Client.Lock 保持一致，expiration 为许可的租期
+func (s *Semaphore) Acquire(ctx context.Context,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) (*Permit, error) {
+	if err := checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	val := uuid.New().String()
+	_, _, err := evalWithRetry(ctx, s.client, semaphoreAcquireLua, []string{s.key},
+		[]any{val, expiration.Milliseconds(), s.permits}, timeout, retry)
+	if err != nil {
+		return nil, err
+	}
+	return s.newPermit(val, expiration), nil
+}
+
+// TryAcquire 尝试获取一个许可，不会重试
+func (s *Semaphore) TryAcquire(ctx context.Context, expiration time.Duration) (*Permit, error) {
+	if err := checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	val := uuid.New().String()
+	res, err := s.client.Eval(ctx, semaphoreAcquireLua, []string{s.key},
+		val, expiration.Milliseconds(), s.permits).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if res != 1 {
+		return nil, ErrFailedToPreemptLock
+	}
+	return s.newPermit(val, expiration), nil
+}
+
+func (s *Semaphore) newPermit(val string, expiration time.Duration) *Permit {
+	return &Permit{
+		c:          s.client,
+		key:        s.key,
+		value:      val,
+		expiration: expiration,
+	}
+}
+
+// Permit 已经拿到的许可
+type Permit struct {
+	c          redis.Cmdable
+	key        string
+	value      string
+	expiration time.Duration
+}
+
+// Refresh 续约许可，只会影响自己的租期
+// 许可已经过期被回收的时候返回 ErrLockNotHold
+func (p *Permit) Refresh(ctx context.Context) error {
+	// 许可和读锁的续约逻辑是一样的
+	res, err := p.c.Eval(ctx, rRefreshLua, []string{p.key}, p.value, p.expiration.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
+
+// Release 释放许可
+func (p *Permit) Release(ctx context.Context) error {
+	res, err := p.c.ZRem(ctx, p.key, p.value).Result()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrLockNotHold
+	}
+	return nil
+}
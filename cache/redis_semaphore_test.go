@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+func TestSemaphore_Acquire(t *testing.T) {
+	evalRes := func(val int64, err error) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		if err != nil {
+			res.SetErr(err)
+		} else {
+			res.SetVal(val)
+		}
+		return res
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), semaphoreAcquireLua, []string{"sem1"}, gomock.Any(), int64(60000), 2).
+					Return(evalRes(0, redis.ErrClosed))
+				return cmd
+			},
+			wantErr: redis.ErrClosed,
+		},
+		{
+			name: "acquired",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), semaphoreAcquireLua, []string{"sem1"}, gomock.Any(), int64(60000), 2).
+					Return(evalRes(1, nil))
+				return cmd
+			},
+		},
+		{
+			// 许可发完了，等别人释放
+			name: "retry and acquired",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					cmd.EXPECT().Eval(gomock.Any(), semaphoreAcquireLua, []string{"sem1"}, gomock.Any(), int64(60000), 2).
+						Return(evalRes(0, nil)),
+					cmd.EXPECT().Eval(gomock.Any(), semaphoreAcquireLua, []string{"sem1"}, gomock.Any(), int64(60000), 2).
+						Return(evalRes(1, nil)),
+				)
+				return cmd
+			},
+		},
+		{
+			name: "no permits",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), semaphoreAcquireLua, []string{"sem1"}, gomock.Any(), int64(60000), 2).
+					Times(3).Return(evalRes(0, nil))
+				return cmd
+			},
+			wantErr: fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			sem, err := NewRedisClient(tc.mock(ctrl)).Semaphore("sem1", 2)
+			assert.NoError(t, err)
+			p, err := sem.Acquire(context.Background(), time.Minute, time.Second,
+				&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2})
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "sem1", p.key)
+			assert.NotEmpty(t, p.value)
+		})
+	}
+}
+
+func TestSemaphore_TryAcquire(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	res := redis.NewCmd(context.Background())
+	res.SetVal(int64(0))
+	cmd.EXPECT().Eval(gomock.Any(), semaphoreAcquireLua, []string{"sem1"}, gomock.Any(), int64(60000), 1).
+		Return(res)
+	sem, err := NewRedisClient(cmd).Semaphore("sem1", 1)
+	assert.NoError(t, err)
+	_, err = sem.TryAcquire(context.Background(), time.Minute)
+	assert.Equal(t, ErrFailedToPreemptLock, err)
+
+	_, err = NewRedisClient(cmd).Semaphore("sem1", 0)
+	assert.Equal(t, ErrInvalidPermits, err)
+}
+
+func TestPermit_Refresh(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  int64
+
+		wantErr error
+	}{
+		{
+			// 租期到了，许可已经被回收
+			name:    "permit reclaimed",
+			val:     0,
+			wantErr: ErrLockNotHold,
+		},
+		{
+			name: "refreshed",
+			val:  1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal(tc.val)
+			cmd.EXPECT().Eval(context.Background(), rRefreshLua, []string{"sem1"}, "value1", int64(60000)).
+				Return(res)
+			p := &Permit{
+				c:          cmd,
+				key:        "sem1",
+				value:      "value1",
+				expiration: time.Minute,
+			}
+			assert.Equal(t, tc.wantErr, p.Refresh(context.Background()))
+		})
+	}
+}
+
+func TestPermit_Release(t *testing.T) {
+	testCases := []struct {
+		name string
+		res  *redis.IntCmd
+
+		wantErr error
+	}{
+		{
+			name:    "zrem error",
+			res:     redis.NewIntResult(0, context.DeadlineExceeded),
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "permit not hold",
+			res:     redis.NewIntResult(0, nil),
+			wantErr: ErrLockNotHold,
+		},
+		{
+			name: "released",
+			res:  redis.NewIntResult(1, nil),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := mocks.NewMockCmdable(ctrl)
+			cmd.EXPECT().ZRem(context.Background(), "sem1", "value1").Return(tc.res)
+			p := &Permit{
+				c:     cmd,
+				key:   "sem1",
+				value: "value1",
+			}
+			assert.Equal(t, tc.wantErr, p.Release(context.Background()))
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoRedisNode = errors.New("redis-lock: 至少需要一个 redis 节点")
+
+	//go:embed lua/redlock.lua
+	redlockLua string
+)
+
+const (
+	// 时钟漂移系数，参考 redis 官方给出的 redlock 实现
+	redlockDriftFactor = 0.01
+	// 固定的时钟漂移补偿
+	redlockDriftOffset = 2 * time.Millisecond
+)
+
+// RedlockClient 基于多个相互独立的 redis 节点实现的 redlock
+// 只有在超过半数节点上加锁成功，并且剩余的有效时间大于 0，才认为加锁成功
+type RedlockClient struct {
+	clients []redis.Cmdable
+	quorum  int
+}
+
+func NewRedlockClient(clients ...redis.Cmdable) (*RedlockClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoRedisNode
+	}
+	return &RedlockClient{
+		clients: clients,
+		quorum:  len(clients)/2 + 1,
+	}, nil
+}
+
+// Lock 支持重试上锁
+// timeout 是在单个节点上加锁的超时时间，应该远小于 expiration
+// 否则一个宕机的节点就会把整个有效时间耗尽
+func (r *RedlockClient) Lock(ctx context.Context,
+	key string,
+	expiration time.Duration,
+	timeout time.Duration,
+	retry RetryStrategy) (*Redlock, error) {
+	var timer *time.Timer
+	val := uuid.New().String()
+	retry = newRetryIterator(retry)
+	for {
+		l, err := r.tryLock(ctx, key, val, expiration, timeout)
+		if err == nil {
+			return l, nil
+		}
+		interval, ok := retry.Next()
+		if !ok {
+			return nil, fmt.Errorf("redis-lock: 超出重试限制, %w", ErrFailedToPreemptLock)
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryLock 只尝试一轮加锁
+func (r *RedlockClient) TryLock(ctx context.Context,
+	key string,
+	expiration time.Duration,
+	timeout time.Duration) (*Redlock, error) {
+	return r.tryLock(ctx, key, uuid.New().String(), expiration, timeout)
+}
+
+func (r *RedlockClient) tryLock(ctx context.Context,
+	key string,
+	val string,
+	expiration time.Duration,
+	timeout time.Duration) (*Redlock, error) {
+	if err := checkExpiration(expiration); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	cnt := r.eachNode(ctx, timeout, func(ctx context.Context, c redis.Cmdable) bool {
+		res, err := c.Eval(ctx, redlockLua, []string{key}, val, expiration.Milliseconds()).Int64()
+		return err == nil && res == 1
+	})
+	validity := r.validity(start, expiration)
+	if cnt >= r.quorum && validity > 0 {
+		return &Redlock{
+			r:          r,
+			key:        key,
+			value:      val,
+			expiration: expiration,
+			timeout:    timeout,
+			validUntil: start.Add(validity),
+		}, nil
+	}
+	// 没有拿到锁，要把已经加上的锁全部释放掉
+	// 这里不能用已经取消的 ctx
+	_, _ = r.unlock(context.WithoutCancel(ctx), key, val, timeout)
+	return nil, ErrFailedToPreemptLock
+}
+
+// validity 计算扣除加锁耗时和时钟漂移之后，锁的剩余有效时间
+func (r *RedlockClient) validity(start time.Time, expiration time.Duration) time.Duration {
+	drift := time.Duration(float64(expiration)*redlockDriftFactor) + redlockDriftOffset
+	return expiration - time.Since(start) - drift
+}
+
+// unlock 在所有节点上释放锁，返回成功释放的节点个数以及遇到的错误
+func (r *RedlockClient) unlock(ctx context.Context, key, val string, timeout time.Duration) (int, error) {
+	var mu sync.Mutex
+	var errs []error
+	cnt := r.eachNode(ctx, timeout, func(ctx context.Context, c redis.Cmdable) bool {
+		res, err := c.Eval(ctx, unLockLua, []string{key}, val).Int64()
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			return false
+		}
+		return res == 1
+	})
+	return cnt, errors.Join(errs...)
+}
+
+// eachNode 并发地在每个节点上执行 fn，返回 fn 返回 true 的节点个数
+func (r *RedlockClient) eachNode(ctx context.Context,
+	timeout time.Duration,
+	fn func(ctx context.Context, c redis.Cmdable) bool) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	cnt := 0
+	for _, c := range r.clients {
+		wg.Add(1)
+		go func(c redis.Cmdable) {
+			defer wg.Done()
+			nctx, cancel := context.WithTimeout(ctx, timeout)
+			ok := fn(nctx, c)
+			cancel()
+			if ok {
+				mu.Lock()
+				cnt++
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return cnt
+}
+
+// Redlock 在多个节点上持有的锁
+type Redlock struct {
+	r          *RedlockClient
+	key        string
+	value      string
+	expiration time.Duration
+	timeout    time.Duration
+	validUntil time.Time
+}
+
+// ValidUntil 锁的有效截止时间，已经扣除了加锁耗时和时钟漂移
+// 超过这个时间之后，就不能再认为自己持有锁
+func (l *Redlock) ValidUntil() time.Time {
+	return l.validUntil
+}
+
+// Refresh 在所有节点上续约，超过半数节点续约成功才算成功
+func (l *Redlock) Refresh(ctx context.Context) error {
+	start := time.Now()
+	cnt := l.r.eachNode(ctx, l.timeout, func(ctx context.Context, c redis.Cmdable) bool {
+		res, err := c.Eval(ctx, refreshLua, []string{l.key}, l.value, l.expiration.Milliseconds()).Int64()
+		return err == nil && res == 1
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	validity := l.r.validity(start, l.expiration)
+	if cnt < l.r.quorum || validity <= 0 {
+		return ErrLockNotHold
+	}
+	l.validUntil = start.Add(validity)
+	return nil
+}
+
+// UnLock 在所有节点上释放锁
+// 只要超过半数节点释放成功就认为成功，因为少数节点上残留的锁不会被别人认为是有效的
+func (l *Redlock) UnLock(ctx context.Context) error {
+	cnt, err := l.r.unlock(ctx, l.key, l.value, l.timeout)
+	if cnt >= l.r.quorum {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHold
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+func TestRedlockClient_TryLock(t *testing.T) {
+	lockRes := func(val any, err error) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		if err != nil {
+			res.SetErr(err)
+		} else {
+			res.SetVal(val)
+		}
+		return res
+	}
+	unlockRes := func(val int64) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		res.SetVal(val)
+		return res
+	}
+	testCases := []struct {
+		name string
+		// 每个节点的加锁结果
+		mock func(ctrl *gomock.Controller) []redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "all nodes locked",
+			mock: func(ctrl *gomock.Controller) []redis.Cmdable {
+				res := make([]redis.Cmdable, 0, 3)
+				for i := 0; i < 3; i++ {
+					cmd := mocks.NewMockCmdable(ctrl)
+					cmd.EXPECT().Eval(gomock.Any(), redlockLua, []string{"key1"}, gomock.Any(), int64(60000)).
+						Return(lockRes(int64(1), nil))
+					res = append(res, cmd)
+				}
+				return res
+			},
+		},
+		{
+			// 一个节点宕机，依旧超过半数
+			name: "majority locked",
+			mock: func(ctrl *gomock.Controller) []redis.Cmdable {
+				res := make([]redis.Cmdable, 0, 3)
+				for i := 0; i < 2; i++ {
+					cmd := mocks.NewMockCmdable(ctrl)
+					cmd.EXPECT().Eval(gomock.Any(), redlockLua, []string{"key1"}, gomock.Any(), int64(60000)).
+						Return(lockRes(int64(1), nil))
+					res = append(res, cmd)
+				}
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), redlockLua, []string{"key1"}, gomock.Any(), int64(60000)).
+					Return(lockRes(nil, redis.ErrClosed))
+				return append(res, cmd)
+			},
+		},
+		{
+			// 没有超过半数，要在所有节点上释放
+			name: "minority locked",
+			mock: func(ctrl *gomock.Controller) []redis.Cmdable {
+				res := make([]redis.Cmdable, 0, 3)
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), redlockLua, []string{"key1"}, gomock.Any(), int64(60000)).
+					Return(lockRes(int64(1), nil))
+				cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, gomock.Any()).
+					Return(unlockRes(1))
+				res = append(res, cmd)
+				for i := 0; i < 2; i++ {
+					cmd = mocks.NewMockCmdable(ctrl)
+					cmd.EXPECT().Eval(gomock.Any(), redlockLua, []string{"key1"}, gomock.Any(), int64(60000)).
+						Return(lockRes(int64(0), nil))
+					cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, gomock.Any()).
+						Return(unlockRes(0))
+					res = append(res, cmd)
+				}
+				return res
+			},
+			wantErr: ErrFailedToPreemptLock,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client, err := NewRedlockClient(tc.mock(ctrl)...)
+			assert.NoError(t, err)
+			l, err := client.TryLock(context.Background(), "key1", time.Minute, time.Second)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "key1", l.key)
+			assert.NotEmpty(t, l.value)
+			assert.True(t, l.ValidUntil().After(time.Now()))
+		})
+	}
+}
+
+func TestRedlock_Refresh(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 每个节点的续约结果
+		results []int64
+
+		wantErr error
+	}{
+		{
+			name:    "refreshed",
+			results: []int64{1, 1, 0},
+		},
+		{
+			name:    "lock not hold",
+			results: []int64{1, 0, 0},
+			wantErr: ErrLockNotHold,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			clients := make([]redis.Cmdable, 0, len(tc.results))
+			for _, val := range tc.results {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(val)
+				cmd.EXPECT().Eval(gomock.Any(), refreshLua, []string{"key1"}, "value1", int64(60000)).
+					Return(res)
+				clients = append(clients, cmd)
+			}
+			client, err := NewRedlockClient(clients...)
+			assert.NoError(t, err)
+			l := &Redlock{
+				r:          client,
+				key:        "key1",
+				value:      "value1",
+				expiration: time.Minute,
+				timeout:    time.Second,
+			}
+			err = l.Refresh(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestRedlock_UnLock(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 每个节点的释放结果
+		results []int64
+
+		wantErr error
+	}{
+		{
+			name:    "unlocked",
+			results: []int64{1, 1, 0},
+		},
+		{
+			name:    "lock not hold",
+			results: []int64{0, 0, 1},
+			wantErr: ErrLockNotHold,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			clients := make([]redis.Cmdable, 0, len(tc.results))
+			for _, val := range tc.results {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(val)
+				cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, "value1").
+					Return(res)
+				clients = append(clients, cmd)
+			}
+			client, err := NewRedlockClient(clients...)
+			assert.NoError(t, err)
+			l := &Redlock{
+				r:       client,
+				key:     "key1",
+				value:   "value1",
+				timeout: time.Second,
+			}
+			err = l.UnLock(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestNewRedlockClient(t *testing.T) {
+	_, err := NewRedlockClient()
+	assert.Equal(t, ErrNoRedisNode, err)
+}
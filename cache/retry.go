@@ -1,6 +1,11 @@
 package cache
 
-import "time"
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
 
 type RetryStrategy interface {
 	// 第一个返回值，重试的间隔
@@ -8,13 +13,303 @@ type RetryStrategy interface {
 	Next() (time.Duration, bool)
 }
 
+// RetryStrategyFactory 重试策略工厂
+// 加锁的时候如果传入的 RetryStrategy 同时实现了这个接口，每次加锁都会调用 NewRetryStrategy 创建一个全新的迭代器
+// 因此同一个策略可以在多个 goroutine、多次加锁之间共享，互不影响
+// 这个包里面所有的重试策略都实现了这个接口
+type RetryStrategyFactory interface {
+	RetryStrategy
+	// NewRetryStrategy 创建一个全新的、状态独立的迭代器
+	NewRetryStrategy() RetryStrategy
+}
+
+// NewRetryStrategyFactory 将自定义的重试策略包装成工厂
+// fn 每次都必须返回一个全新的迭代器
+func NewRetryStrategyFactory(fn func() RetryStrategy) RetryStrategyFactory {
+	return &retryStrategyFactory{fn: fn}
+}
+
+type retryStrategyFactory struct {
+	fn   func() RetryStrategy
+	once sync.Once
+	mu   sync.Mutex
+	// 直接调用 Next 的时候使用的迭代器
+	shared RetryStrategy
+}
+
+func (r *retryStrategyFactory) Next() (time.Duration, bool) {
+	r.once.Do(func() {
+		r.shared = r.fn()
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shared.Next()
+}
+
+func (r *retryStrategyFactory) NewRetryStrategy() RetryStrategy {
+	return r.fn()
+}
+
+// newRetryIterator 返回本次加锁使用的迭代器
+func newRetryIterator(retry RetryStrategy) RetryStrategy {
+	if f, ok := retry.(RetryStrategyFactory); ok {
+		return f.NewRetryStrategy()
+	}
+	return retry
+}
+
+var _ RetryStrategyFactory = &FixedIntervalRetryStrategy{}
+
 type FixedIntervalRetryStrategy struct {
 	Interval time.Duration
 	MaxCnt   int
+	mu       sync.Mutex
 	cnt      int
 }
 
 func (f *FixedIntervalRetryStrategy) Next() (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.cnt++
 	return f.Interval, f.cnt <= f.MaxCnt
 }
+
+func (f *FixedIntervalRetryStrategy) NewRetryStrategy() RetryStrategy {
+	return &FixedIntervalRetryStrategy{
+		Interval: f.Interval,
+		MaxCnt:   f.MaxCnt,
+	}
+}
+
+// Jitter 随机抖动的方式，避免大量等待者在同一时刻重试
+type Jitter int
+
+const (
+	// NoJitter 不抖动
+	NoJitter Jitter = iota
+	// FullJitter 在 [0, 间隔] 之间随机
+	FullJitter
+	// EqualJitter 在 [间隔/2, 间隔] 之间随机
+	EqualJitter
+	// DecorrelatedJitter 在 [初始间隔, 上一次间隔 * 3] 之间随机
+	DecorrelatedJitter
+)
+
+var _ RetryStrategyFactory = &ExponentialBackoffRetryStrategy{}
+
+// ExponentialBackoffRetryStrategy 指数退避重试
+// 第 n 次重试的间隔为 InitialInterval * Multiplier^(n-1)，再按照 Jitter 进行抖动，并且不超过 MaxInterval
+type ExponentialBackoffRetryStrategy struct {
+	// 初始重试间隔
+	InitialInterval time.Duration
+	// 最大重试间隔，<= 0 表示不限制
+	MaxInterval time.Duration
+	// 间隔增长的倍数，<= 1 时使用 2
+	Multiplier float64
+	// 最大重试次数，<= 0 表示不限制
+	MaxCnt int
+	Jitter Jitter
+
+	mu  sync.Mutex
+	cnt int
+	// 上一次的重试间隔，DecorrelatedJitter 使用
+	prev time.Duration
+}
+
+func (e *ExponentialBackoffRetryStrategy) Next() (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cnt++
+	if e.MaxCnt > 0 && e.cnt > e.MaxCnt {
+		return 0, false
+	}
+	var interval time.Duration
+	switch e.Jitter {
+	case FullJitter:
+		interval = randDuration(0, e.backoff())
+	case EqualJitter:
+		backoff := e.backoff()
+		interval = backoff/2 + randDuration(0, backoff-backoff/2)
+	case DecorrelatedJitter:
+		if e.prev == 0 {
+			e.prev = e.InitialInterval
+		}
+		upper := time.Duration(math.MaxInt64)
+		// 没有设置 MaxInterval 的时候，多次重试之后乘以 3 会溢出
+		if e.prev <= math.MaxInt64/3 {
+			upper = e.prev * 3
+		}
+		interval = e.capInterval(randDuration(e.InitialInterval, upper))
+		e.prev = interval
+	default:
+		interval = e.backoff()
+	}
+	return interval, true
+}
+
+// backoff 没有抖动的情况下，本次的重试间隔
+func (e *ExponentialBackoffRetryStrategy) backoff() time.Duration {
+	multiplier := e.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	interval := float64(e.InitialInterval) * math.Pow(multiplier, float64(e.cnt-1))
+	// 防止溢出
+	if interval >= math.MaxInt64 {
+		return e.capInterval(math.MaxInt64)
+	}
+	return e.capInterval(time.Duration(interval))
+}
+
+func (e *ExponentialBackoffRetryStrategy) capInterval(interval time.Duration) time.Duration {
+	if e.MaxInterval > 0 && interval > e.MaxInterval {
+		return e.MaxInterval
+	}
+	return interval
+}
+
+func (e *ExponentialBackoffRetryStrategy) NewRetryStrategy() RetryStrategy {
+	return &ExponentialBackoffRetryStrategy{
+		InitialInterval: e.InitialInterval,
+		MaxInterval:     e.MaxInterval,
+		Multiplier:      e.Multiplier,
+		MaxCnt:          e.MaxCnt,
+		Jitter:          e.Jitter,
+	}
+}
+
+// randDuration 返回 [min, max] 之间的随机时长
+func randDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	n := int64(max - min)
+	if n == math.MaxInt64 {
+		// n + 1 会溢出
+		return min + time.Duration(rand.Int63())
+	}
+	return min + time.Duration(rand.Int63n(n+1))
+}
+
+// WithMaxInterval 限制重试间隔不超过 maxInterval
+func WithMaxInterval(retry RetryStrategy, maxInterval time.Duration) RetryStrategyFactory {
+	return &wrappedRetryStrategy{
+		retry: retry,
+		newNext: func() func(retry RetryStrategy) (time.Duration, bool) {
+			return func(retry RetryStrategy) (time.Duration, bool) {
+				interval, ok := retry.Next()
+				if interval > maxInterval {
+					interval = maxInterval
+				}
+				return interval, ok
+			}
+		},
+	}
+}
+
+// WithMaxCnt 限制最多重试 maxCnt 次
+func WithMaxCnt(retry RetryStrategy, maxCnt int) RetryStrategyFactory {
+	return &wrappedRetryStrategy{
+		retry: retry,
+		newNext: func() func(retry RetryStrategy) (time.Duration, bool) {
+			cnt := 0
+			return func(retry RetryStrategy) (time.Duration, bool) {
+				cnt++
+				if cnt > maxCnt {
+					return 0, false
+				}
+				return retry.Next()
+			}
+		},
+	}
+}
+
+// WithMaxElapsed 限制重试的总时长
+// 从第一次调用 Next 开始计时，如果等待下一次重试会超过 maxElapsed，就不再重试
+func WithMaxElapsed(retry RetryStrategy, maxElapsed time.Duration) RetryStrategyFactory {
+	return &wrappedRetryStrategy{
+		retry: retry,
+		newNext: func() func(retry RetryStrategy) (time.Duration, bool) {
+			var start time.Time
+			return func(retry RetryStrategy) (time.Duration, bool) {
+				if start.IsZero() {
+					start = time.Now()
+				}
+				interval, ok := retry.Next()
+				if !ok || time.Since(start)+interval > maxElapsed {
+					return 0, false
+				}
+				return interval, true
+			}
+		},
+	}
+}
+
+// WithDeadline 限制重试的截止时间，如果等待下一次重试会超过 deadline，就不再重试
+func WithDeadline(retry RetryStrategy, deadline time.Time) RetryStrategyFactory {
+	return &wrappedRetryStrategy{
+		retry: retry,
+		newNext: func() func(retry RetryStrategy) (time.Duration, bool) {
+			return func(retry RetryStrategy) (time.Duration, bool) {
+				interval, ok := retry.Next()
+				if !ok || time.Now().Add(interval).After(deadline) {
+					return 0, false
+				}
+				return interval, true
+			}
+		},
+	}
+}
+
+// Chain 组合多个重试策略，前一个策略不再重试之后，接着使用后一个策略
+// 例如先快速重试几次，再使用指数退避
+func Chain(retries ...RetryStrategy) RetryStrategyFactory {
+	return NewRetryStrategyFactory(func() RetryStrategy {
+		iterators := make([]RetryStrategy, 0, len(retries))
+		for _, r := range retries {
+			iterators = append(iterators, newRetryIterator(r))
+		}
+		return &chainRetryStrategy{retries: iterators}
+	})
+}
+
+type chainRetryStrategy struct {
+	retries []RetryStrategy
+}
+
+func (c *chainRetryStrategy) Next() (time.Duration, bool) {
+	for len(c.retries) > 0 {
+		interval, ok := c.retries[0].Next()
+		if ok {
+			return interval, true
+		}
+		c.retries = c.retries[1:]
+	}
+	return 0, false
+}
+
+// wrappedRetryStrategy 在另外一个重试策略的基础上做限制
+// newNext 创建限制逻辑，每个迭代器都会拥有自己的状态（例如计数、开始时间）
+type wrappedRetryStrategy struct {
+	retry   RetryStrategy
+	newNext func() func(retry RetryStrategy) (time.Duration, bool)
+
+	mu   sync.Mutex
+	next func(retry RetryStrategy) (time.Duration, bool)
+}
+
+func (w *wrappedRetryStrategy) Next() (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.next == nil {
+		w.next = w.newNext()
+	}
+	return w.next(w.retry)
+}
+
+func (w *wrappedRetryStrategy) NewRetryStrategy() RetryStrategy {
+	return &wrappedRetryStrategy{
+		retry:   newRetryIterator(w.retry),
+		newNext: w.newNext,
+	}
+}
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect 调用 Next 直到不再重试，最多调用 max 次
+func collect(retry RetryStrategy, max int) []time.Duration {
+	res := make([]time.Duration, 0, max)
+	for i := 0; i < max; i++ {
+		interval, ok := retry.Next()
+		if !ok {
+			break
+		}
+		res = append(res, interval)
+	}
+	return res
+}
+
+func TestExponentialBackoffRetryStrategy_Next(t *testing.T) {
+	testCases := []struct {
+		name  string
+		retry *ExponentialBackoffRetryStrategy
+		// 最多调用多少次 Next
+		max int
+
+		wantIntervals []time.Duration
+	}{
+		{
+			name: "no jitter",
+			retry: &ExponentialBackoffRetryStrategy{
+				InitialInterval: time.Millisecond,
+				MaxCnt:          4,
+			},
+			max:           10,
+			wantIntervals: []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond},
+		},
+		{
+			name: "multiplier",
+			retry: &ExponentialBackoffRetryStrategy{
+				InitialInterval: time.Millisecond,
+				Multiplier:      3,
+				MaxCnt:          3,
+			},
+			max:           10,
+			wantIntervals: []time.Duration{time.Millisecond, 3 * time.Millisecond, 9 * time.Millisecond},
+		},
+		{
+			name: "max interval",
+			retry: &ExponentialBackoffRetryStrategy{
+				InitialInterval: time.Millisecond,
+				MaxInterval:     3 * time.Millisecond,
+			},
+			max:           4,
+			wantIntervals: []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond},
+		},
+		{
+			// 很多次之后也不能溢出
+			name: "overflow",
+			retry: &ExponentialBackoffRetryStrategy{
+				InitialInterval: time.Second,
+				MaxInterval:     time.Minute,
+			},
+			max: 100,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			intervals := collect(tc.retry, tc.max)
+			if tc.wantIntervals == nil {
+				assert.Len(t, intervals, tc.max)
+				assert.Equal(t, time.Minute, intervals[len(intervals)-1])
+				return
+			}
+			assert.Equal(t, tc.wantIntervals, intervals)
+		})
+	}
+}
+
+func TestExponentialBackoffRetryStrategy_Jitter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		jitter Jitter
+		// 第 i 次重试间隔的合法范围
+		wantRange func(i int) (time.Duration, time.Duration)
+	}{
+		{
+			name:   "full jitter",
+			jitter: FullJitter,
+			wantRange: func(i int) (time.Duration, time.Duration) {
+				return 0, min(time.Millisecond<<i, 50*time.Millisecond)
+			},
+		},
+		{
+			name:   "equal jitter",
+			jitter: EqualJitter,
+			wantRange: func(i int) (time.Duration, time.Duration) {
+				backoff := min(time.Millisecond<<i, 50*time.Millisecond)
+				return backoff / 2, backoff
+			},
+		},
+		{
+			name:   "decorrelated jitter",
+			jitter: DecorrelatedJitter,
+			wantRange: func(i int) (time.Duration, time.Duration) {
+				return time.Millisecond, 50 * time.Millisecond
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retry := &ExponentialBackoffRetryStrategy{
+				InitialInterval: time.Millisecond,
+				MaxInterval:     50 * time.Millisecond,
+				MaxCnt:          20,
+				Jitter:          tc.jitter,
+			}
+			intervals := collect(retry, 100)
+			assert.Len(t, intervals, 20)
+			for i, interval := range intervals {
+				low, high := tc.wantRange(i)
+				assert.GreaterOrEqual(t, interval, low)
+				assert.LessOrEqual(t, interval, high)
+			}
+		})
+	}
+}
+
+// 没有设置 MaxInterval 的时候，间隔增长到上限也不能溢出
+func TestExponentialBackoffRetryStrategy_Overflow(t *testing.T) {
+	for _, jitter := range []Jitter{NoJitter, FullJitter, EqualJitter, DecorrelatedJitter} {
+		retry := &ExponentialBackoffRetryStrategy{
+			InitialInterval: time.Duration(math.MaxInt64 / 2),
+			MaxCnt:          100,
+			Jitter:          jitter,
+		}
+		intervals := collect(retry, 200)
+		assert.Len(t, intervals, 100)
+		for _, interval := range intervals {
+			assert.GreaterOrEqual(t, interval, time.Duration(0))
+			if jitter == DecorrelatedJitter {
+				assert.GreaterOrEqual(t, interval, retry.InitialInterval)
+			}
+		}
+	}
+}
+
+func TestRetryStrategy_Wrappers(t *testing.T) {
+	fixed := &FixedIntervalRetryStrategy{Interval: time.Millisecond * 10, MaxCnt: 5}
+	testCases := []struct {
+		name  string
+		retry RetryStrategy
+
+		wantIntervals []time.Duration
+	}{
+		{
+			name:          "max interval",
+			retry:         WithMaxInterval(fixed, time.Millisecond*5),
+			wantIntervals: []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond},
+		},
+		{
+			name:          "max cnt",
+			retry:         WithMaxCnt(fixed, 2),
+			wantIntervals: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond},
+		},
+		{
+			// 等待下一次重试就会超过总时长
+			name:          "max elapsed",
+			retry:         WithMaxElapsed(fixed, time.Millisecond*5),
+			wantIntervals: []time.Duration{},
+		},
+		{
+			name:          "deadline exceeded",
+			retry:         WithDeadline(fixed, time.Now()),
+			wantIntervals: []time.Duration{},
+		},
+		{
+			name: "chain",
+			retry: Chain(&FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 2},
+				&ExponentialBackoffRetryStrategy{InitialInterval: time.Millisecond * 10, MaxCnt: 2}),
+			wantIntervals: []time.Duration{time.Millisecond, time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 每次加锁都会创建新的迭代器，这里模拟两次加锁
+			for i := 0; i < 2; i++ {
+				intervals := collect(newRetryIterator(tc.retry), 100)
+				assert.Equal(t, tc.wantIntervals, intervals)
+			}
+		})
+	}
+}
+
+func TestRetryStrategyFactory(t *testing.T) {
+	// 同一个策略在多个 goroutine 之间共享，每个迭代器都是独立的
+	retry := &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 3}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Len(t, collect(newRetryIterator(retry), 100), 3)
+		}()
+	}
+	wg.Wait()
+
+	// 自定义的策略
+	factory := NewRetryStrategyFactory(func() RetryStrategy {
+		return &FixedIntervalRetryStrategy{Interval: time.Millisecond, MaxCnt: 1}
+	})
+	assert.Len(t, collect(newRetryIterator(factory), 100), 1)
+	assert.Len(t, collect(newRetryIterator(factory), 100), 1)
+	// 直接调用 Next 的时候共享同一个迭代器
+	assert.Len(t, collect(factory, 100), 1)
+	assert.Len(t, collect(factory, 100), 0)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// LockOptions WithLock 的参数
+type LockOptions struct {
+	// 锁的过期时间，不能小于 1 毫秒
+	Expiration time.Duration
+	// 单次加锁、续约、释放的超时时间，默认 1 秒
+	Timeout time.Duration
+	// 加锁的重试策略，为 nil 时不重试
+	Retry RetryStrategy
+	// 续约间隔，默认 Expiration / 3
+	RefreshInterval time.Duration
+	// 续约持续失败多久之后认为锁已经丢失，默认 Expiration - RefreshInterval
+	GracePeriod time.Duration
+}
+
+func (o LockOptions) withDefault() LockOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = time.Second
+	}
+	if o.Retry == nil {
+		o.Retry = &FixedIntervalRetryStrategy{}
+	}
+	if o.RefreshInterval <= 0 {
+		o.RefreshInterval = o.Expiration / 3
+	}
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = o.Expiration - o.RefreshInterval
+	}
+	return o
+}
+
+// WithLock 加锁之后执行 fn，参考 WithLock 函数
+func (c *Client) WithLock(ctx context.Context, key string, opts LockOptions, fn func(ctx context.Context) error) error {
+	return WithLock(ctx, c, key, opts, fn)
+}
+
+// WithLock 加锁之后执行 fn，fn 返回（包括 panic）之后一定会释放锁
+// fn 执行期间会通过看门狗自动续约，如果锁丢失了，传给 fn 的 ctx 会被取消，fn 应该尽快返回
+// 返回的错误是以下错误的组合，可以使用 errors.Is 判断：
+// 1. 加锁失败的错误，这种情况下 fn 不会被执行
+// 2. fn 返回的错误
+// 3. fn 执行期间锁丢失，ErrLockLost
+// 4. 释放锁的错误
+func WithLock(ctx context.Context,
+	locker Locker,
+	key string,
+	opts LockOptions,
+	fn func(ctx context.Context) error) (err error) {
+	if err = checkExpiration(opts.Expiration); err != nil {
+		return err
+	}
+	opts = opts.withDefault()
+	l, err := locker.Lock(ctx, key, opts.Expiration, opts.Timeout, opts.Retry)
+	if err != nil {
+		return err
+	}
+	wctx := l.WatchDog(ctx, opts.RefreshInterval, opts.Timeout, opts.GracePeriod)
+	defer func() {
+		var lostErr error
+		if cause := context.Cause(wctx); errors.Is(cause, ErrLockLost) {
+			lostErr = cause
+		}
+		// 这里不能用已经取消的 ctx
+		uctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opts.Timeout)
+		defer cancel()
+		unlockErr := l.UnLock(uctx)
+		if lostErr != nil && errors.Is(unlockErr, ErrLockNotHold) {
+			// 锁已经丢失了，释放失败是意料之中的
+			unlockErr = nil
+		}
+		err = errors.Join(err, lostErr, unlockErr)
+	}()
+	return fn(wctx)
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+func TestWithLock(t *testing.T) {
+	errBiz := errors.New("biz error")
+	testCases := []struct {
+		name   string
+		before func(t *testing.T, m *MemoryLocker)
+		opts   LockOptions
+		fn     func(t *testing.T, m *MemoryLocker) func(ctx context.Context) error
+
+		wantErrs []error
+		// fn 是否执行了
+		wantCalled bool
+		// 结束之后锁是否空闲
+		wantReleased bool
+	}{
+		{
+			name:   "invalid expiration",
+			before: func(t *testing.T, m *MemoryLocker) {},
+			fn: func(t *testing.T, m *MemoryLocker) func(ctx context.Context) error {
+				return func(ctx context.Context) error { return nil }
+			},
+			wantErrs: []error{ErrInvalidExpiration},
+		},
+		{
+			name: "others hold lock",
+			before: func(t *testing.T, m *MemoryLocker) {
+				_, err := m.TryLock(context.Background(), "key1", time.Minute)
+				require.NoError(t, err)
+			},
+			opts: LockOptions{Expiration: time.Minute},
+			fn: func(t *testing.T, m *MemoryLocker) func(ctx context.Context) error {
+				return func(ctx context.Context) error { return nil }
+			},
+			wantErrs: []error{ErrFailedToPreemptLock},
+		},
+		{
+			name:   "fn error",
+			before: func(t *testing.T, m *MemoryLocker) {},
+			opts:   LockOptions{Expiration: time.Minute},
+			fn: func(t *testing.T, m *MemoryLocker) func(ctx context.Context) error {
+				return func(ctx context.Context) error { return errBiz }
+			},
+			wantErrs:     []error{errBiz},
+			wantCalled:   true,
+			wantReleased: true,
+		},
+		{
+			// 执行时间比过期时间长，依靠续约一直持有锁
+			name:   "auto refreshed",
+			before: func(t *testing.T, m *MemoryLocker) {},
+			opts:   LockOptions{Expiration: time.Millisecond * 30},
+			fn: func(t *testing.T, m *MemoryLocker) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					time.Sleep(time.Millisecond * 100)
+					_, err := m.TryLock(context.Background(), "key1", time.Minute)
+					assert.Equal(t, ErrFailedToPreemptLock, err)
+					return ctx.Err()
+				}
+			},
+			wantCalled:   true,
+			wantReleased: true,
+		},
+		{
+			name:   "lock lost",
+			before: func(t *testing.T, m *MemoryLocker) {},
+			opts:   LockOptions{Expiration: time.Millisecond * 30},
+			fn: func(t *testing.T, m *MemoryLocker) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					// 模拟锁被别人抢走
+					m.mu.Lock()
+					m.locks["key1"] = memoryLockEntry{value: "other", deadline: time.Now().Add(time.Minute)}
+					m.mu.Unlock()
+					<-ctx.Done()
+					return ctx.Err()
+				}
+			},
+			wantErrs:   []error{context.Canceled, ErrLockLost},
+			wantCalled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMemoryLocker()
+			tc.before(t, m)
+			called := false
+			fn := tc.fn(t, m)
+			err := WithLock(context.Background(), m, "key1", tc.opts, func(ctx context.Context) error {
+				called = true
+				return fn(ctx)
+			})
+			assert.Equal(t, tc.wantCalled, called)
+			if len(tc.wantErrs) == 0 {
+				assert.NoError(t, err)
+			}
+			for _, wantErr := range tc.wantErrs {
+				assert.ErrorIs(t, err, wantErr)
+			}
+			if tc.wantReleased {
+				_, err = m.TryLock(context.Background(), "key1", time.Minute)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWithLock_Panic(t *testing.T) {
+	m := NewMemoryLocker()
+	assert.Panics(t, func() {
+		_ = WithLock(context.Background(), m, "key1", LockOptions{Expiration: time.Minute},
+			func(ctx context.Context) error {
+				panic("biz panic")
+			})
+	})
+	_, err := m.TryLock(context.Background(), "key1", time.Minute)
+	assert.NoError(t, err)
+}
+
+func TestClient_WithLock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := mocks.NewMockCmdable(ctrl)
+	lockRes := redis.NewCmd(context.Background())
+	lockRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), lockLua, []string{"key1", "{key1}:fencing"}, gomock.Any(), int64(60000)).
+		Return(lockRes)
+	unlockRes := redis.NewCmd(context.Background())
+	unlockRes.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), unLockLua, []string{"key1"}, gomock.Any()).
+		Return(unlockRes)
+
+	err := NewRedisClient(cmd).WithLock(context.Background(), "key1", LockOptions{Expiration: time.Minute},
+		func(ctx context.Context) error {
+			return nil
+		})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// unsafeQueue 不加锁的队列操作，用于在阻塞队列之间复用批量操作的逻辑
+// 所有方法都必须在锁范围内调用
+type unsafeQueue[T any] interface {
+	length() int
+	// bounded 是否有界，无界队列的 capacity 没有意义
+	bounded() bool
+	capacity() int
+	// push 调用方保证队列没满
+	push(val T)
+	// pop 调用方保证队列不为空
+	pop() T
+}
+
+// enqueueBatch 批量入队的通用逻辑，调用前不需要加锁
+func enqueueBatch[T any](ctx context.Context,
+	mu sync.Locker,
+	readCond, writeCond *cond,
+	q unsafeQueue[T],
+	vals []T) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	// 容量是创建的时候就确定的，这里不需要加锁
+	bounded, capacity := q.bounded(), q.capacity()
+	if bounded && len(vals) > capacity {
+		// 永远也放不下
+		return ErrOutOfCapacity
+	}
+	mu.Lock()
+	for !writeCond.closed && bounded && capacity-q.length() < len(vals) {
+		// 注意：这里接下来要进行睡眠，因此里面会把锁释放
+		ch := writeCond.signalCh()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			mu.Lock()
+		}
+	}
+	if writeCond.closed {
+		mu.Unlock()
+		return ErrQueueClosed
+	}
+	for _, val := range vals {
+		q.push(val)
+	}
+	readCond.broadcast()
+	return nil
+}
+
+// dequeueBatch 批量出队的通用逻辑，调用前不需要加锁
+func dequeueBatch[T any](ctx context.Context,
+	mu sync.Locker,
+	readCond, writeCond *cond,
+	q unsafeQueue[T],
+	max int,
+	maxWait time.Duration) ([]T, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if max <= 0 {
+		return []T{}, nil
+	}
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	res := make([]T, 0, min(max, 64))
+	mu.Lock()
+	for {
+		popped := 0
+		for len(res) < max && q.length() > 0 {
+			res = append(res, q.pop())
+			popped++
+		}
+		if len(res) == max || (len(res) > 0 && maxWait <= 0) {
+			if popped > 0 {
+				writeCond.broadcast()
+			} else {
+				mu.Unlock()
+			}
+			return res, nil
+		}
+		if popped > 0 {
+			// 先唤醒等待写入的人，腾出来的位置才能被利用上
+			writeCond.broadcast()
+			if timer == nil {
+				// 从拿到第一个元素开始计时
+				timer = time.NewTimer(maxWait)
+				timeout = timer.C
+			}
+			mu.Lock()
+			if q.length() > 0 {
+				continue
+			}
+		}
+		if readCond.closed {
+			// 已经关闭并且取完了，不会再有新元素了
+			mu.Unlock()
+			if len(res) > 0 {
+				return res, nil
+			}
+			return nil, ErrQueueClosed
+		}
+		ch := readCond.signalCh()
+		select {
+		case <-ch:
+			mu.Lock()
+		case <-timeout:
+			return res, nil
+		case <-ctx.Done():
+			if len(res) > 0 {
+				return res, nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// drainTo 取出所有元素的通用逻辑，调用前不需要加锁
+func drainTo[T any](mu sync.Locker, writeCond *cond, q unsafeQueue[T], dst []T) []T {
+	mu.Lock()
+	n := q.length()
+	if n == 0 {
+		mu.Unlock()
+		return dst
+	}
+	dst = slices.Grow(dst, n)
+	for i := 0; i < n; i++ {
+		dst = append(dst, q.pop())
+	}
+	writeCond.broadcast()
+	return dst
+}
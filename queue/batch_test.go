@@ -0,0 +1,270 @@
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBatchQueue_EnqueueBatch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		before  func(t *testing.T, q BatchQueue[int])
+		vals    []int
+		timeout time.Duration
+
+		wantErr  error
+		wantVals []int
+	}{
+		{
+			name:     "empty vals",
+			before:   func(t *testing.T, q BatchQueue[int]) {},
+			timeout:  time.Second,
+			wantVals: []int{},
+		},
+		{
+			name:     "enqueued",
+			before:   func(t *testing.T, q BatchQueue[int]) {},
+			vals:     []int{1, 2, 3},
+			timeout:  time.Second,
+			wantVals: []int{1, 2, 3},
+		},
+		{
+			name:     "invalid context",
+			before:   func(t *testing.T, q BatchQueue[int]) {},
+			vals:     []int{1, 2, 3},
+			timeout:  -time.Second,
+			wantErr:  context.DeadlineExceeded,
+			wantVals: []int{},
+		},
+		{
+			name:     "out of capacity",
+			before:   func(t *testing.T, q BatchQueue[int]) {},
+			vals:     []int{1, 2, 3, 4, 5},
+			timeout:  time.Second,
+			wantErr:  ErrOutOfCapacity,
+			wantVals: []int{},
+		},
+		{
+			// 空间不够放下所有元素，一个都不会入队
+			name: "not enough space",
+			before: func(t *testing.T, q BatchQueue[int]) {
+				require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2}))
+			},
+			vals:     []int{3, 4, 5},
+			timeout:  time.Millisecond * 10,
+			wantErr:  context.DeadlineExceeded,
+			wantVals: []int{1, 2},
+		},
+	}
+	for name, newQueue := range queuesWith[BatchQueue[int]](t, 4, abilityBatch) {
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.name, func(t *testing.T) {
+				q := newQueue()
+				tc.before(t, q)
+				ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+				defer cancel()
+				err := q.EnqueueBatch(ctx, tc.vals)
+				assert.Equal(t, tc.wantErr, err)
+				assert.Equal(t, tc.wantVals, q.DrainTo([]int{}))
+			})
+		}
+	}
+
+	for name, newQueue := range queuesWith[BatchQueue[int]](t, 4, abilityBatch) {
+		t.Run(name+"/enqueue after dequeue", func(t *testing.T) {
+			q := newQueue()
+			require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2, 3}))
+			go func() {
+				time.Sleep(time.Millisecond * 50)
+				_, err := q.DequeueBatch(context.Background(), 2, 0)
+				require.NoError(t, err)
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, q.EnqueueBatch(ctx, []int{4, 5, 6}))
+			assert.Equal(t, []int{3, 4, 5, 6}, q.DrainTo(nil))
+		})
+	}
+}
+
+func TestBatchQueue_EnqueueBatchZeroCapacity(t *testing.T) {
+	for _, f := range queueFixtures {
+		if f.abilities&abilityBatch == 0 {
+			continue
+		}
+		t.Run(f.name, func(t *testing.T) {
+			q := f.newQueue(0).(BatchQueue[int])
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := q.EnqueueBatch(ctx, []int{1, 2, 3})
+			if !f.boundless {
+				// 容量为 0 的时候永远也放不下
+				assert.Equal(t, ErrOutOfCapacity, err)
+				assert.Empty(t, q.DrainTo(nil))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 2, 3}, q.DrainTo(nil))
+		})
+	}
+}
+
+func TestBatchQueue_DequeueBatch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		before  func(t *testing.T, q BatchQueue[int])
+		max     int
+		maxWait time.Duration
+		timeout time.Duration
+
+		wantErr  error
+		wantVals []int
+		// 剩下的元素
+		wantLeft []int
+	}{
+		{
+			name: "invalid context",
+			before: func(t *testing.T, q BatchQueue[int]) {
+				require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2}))
+			},
+			max:      2,
+			timeout:  -time.Second,
+			wantErr:  context.DeadlineExceeded,
+			wantLeft: []int{1, 2},
+		},
+		{
+			name:     "invalid max",
+			before:   func(t *testing.T, q BatchQueue[int]) {},
+			max:      0,
+			timeout:  time.Second,
+			wantVals: []int{},
+			wantLeft: []int{},
+		},
+		{
+			name:     "empty timeout",
+			before:   func(t *testing.T, q BatchQueue[int]) {},
+			max:      2,
+			maxWait:  time.Second,
+			timeout:  time.Millisecond * 10,
+			wantErr:  context.DeadlineExceeded,
+			wantLeft: []int{},
+		},
+		{
+			name: "full batch",
+			before: func(t *testing.T, q BatchQueue[int]) {
+				require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2, 3}))
+			},
+			max:      2,
+			maxWait:  time.Second,
+			timeout:  time.Second,
+			wantVals: []int{1, 2},
+			wantLeft: []int{3},
+		},
+		{
+			// 不等待，有多少拿多少
+			name: "no wait",
+			before: func(t *testing.T, q BatchQueue[int]) {
+				require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2}))
+			},
+			max:      3,
+			timeout:  time.Second,
+			wantVals: []int{1, 2},
+			wantLeft: []int{},
+		},
+		{
+			name: "max wait expired",
+			before: func(t *testing.T, q BatchQueue[int]) {
+				require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2}))
+			},
+			max:      3,
+			maxWait:  time.Millisecond * 10,
+			timeout:  time.Second,
+			wantVals: []int{1, 2},
+			wantLeft: []int{},
+		},
+		{
+			// 凑批的时候 ctx 过期，返回已经拿到的元素
+			name: "context expired with partial batch",
+			before: func(t *testing.T, q BatchQueue[int]) {
+				require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2}))
+			},
+			max:      3,
+			maxWait:  time.Second,
+			timeout:  time.Millisecond * 10,
+			wantVals: []int{1, 2},
+			wantLeft: []int{},
+		},
+	}
+	for name, newQueue := range queuesWith[BatchQueue[int]](t, 4, abilityBatch) {
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.name, func(t *testing.T) {
+				q := newQueue()
+				tc.before(t, q)
+				ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+				defer cancel()
+				vals, err := q.DequeueBatch(ctx, tc.max, tc.maxWait)
+				assert.Equal(t, tc.wantErr, err)
+				assert.Equal(t, tc.wantVals, vals)
+				assert.Equal(t, tc.wantLeft, q.DrainTo([]int{}))
+			})
+		}
+	}
+
+	for name, newQueue := range queuesWith[BatchQueue[int]](t, 4, abilityBatch) {
+		t.Run(name+"/fill batch while waiting", func(t *testing.T) {
+			q := newQueue()
+			go func() {
+				for i := 1; i <= 3; i++ {
+					time.Sleep(time.Millisecond * 20)
+					require.NoError(t, q.Enqueue(context.Background(), i))
+				}
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			vals, err := q.DequeueBatch(ctx, 3, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 2, 3}, vals)
+		})
+	}
+
+	for name, newQueue := range queuesWith[BatchQueue[int]](t, 2, abilityBatch) {
+		// 凑批期间腾出来的位置，要能让阻塞的生产者写进来
+		t.Run(name+"/wake up writers while waiting", func(t *testing.T) {
+			q := newQueue()
+			go func() {
+				for i := 1; i <= 4; i++ {
+					require.NoError(t, q.Enqueue(context.Background(), i))
+				}
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			vals, err := q.DequeueBatch(ctx, 4, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 2, 3, 4}, vals)
+		})
+	}
+}
+
+func TestBatchQueue_DrainTo(t *testing.T) {
+	for name, newQueue := range queuesWith[BatchQueue[int]](t, 4, abilityBatch) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			assert.Equal(t, []int{0}, q.DrainTo([]int{0}))
+			require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2, 3, 4}))
+
+			// 队列满了，阻塞的生产者在 DrainTo 之后被唤醒
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				require.NoError(t, q.Enqueue(context.Background(), 5))
+			}()
+			time.Sleep(time.Millisecond * 10)
+			assert.Equal(t, []int{0, 1, 2, 3, 4}, q.DrainTo([]int{0}))
+			<-done
+			assert.Equal(t, []int{5}, q.DrainTo(nil))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockingQueue_TryEnqueueDequeue(t *testing.T) {
+	for name, newQueue := range queuesWith[BlockingQueue[int]](t, 2, abilityBlocking) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			assert.Equal(t, 2, q.Cap())
+			_, err := q.TryDequeue()
+			assert.Equal(t, ErrEmptyQueue, err)
+			_, err = q.Peek()
+			assert.Equal(t, ErrEmptyQueue, err)
+
+			require.NoError(t, q.TryEnqueue(1))
+			require.NoError(t, q.TryEnqueue(2))
+			assert.Equal(t, ErrOutOfCapacity, q.TryEnqueue(3))
+			assert.Equal(t, 2, q.Len())
+
+			// Peek 不会出队
+			for i := 0; i < 2; i++ {
+				val, err := q.Peek()
+				require.NoError(t, err)
+				assert.Equal(t, 1, val)
+			}
+			assert.Equal(t, 2, q.Len())
+
+			val, err := q.TryDequeue()
+			require.NoError(t, err)
+			assert.Equal(t, 1, val)
+			val, err = q.Peek()
+			require.NoError(t, err)
+			assert.Equal(t, 2, val)
+			assert.Equal(t, 1, q.Len())
+		})
+	}
+}
+
+func TestBlockingQueue_TryWakeUp(t *testing.T) {
+	for name, newQueue := range queuesWith[BlockingQueue[int]](t, 1, abilityBlocking) {
+		t.Run(name+" try enqueue wakes dequeue", func(t *testing.T) {
+			q := newQueue()
+			go func() {
+				time.Sleep(time.Millisecond * 10)
+				assert.NoError(t, q.TryEnqueue(1))
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			val, err := q.Dequeue(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 1, val)
+		})
+
+		t.Run(name+" try dequeue wakes enqueue", func(t *testing.T) {
+			q := newQueue()
+			require.NoError(t, q.TryEnqueue(1))
+			go func() {
+				time.Sleep(time.Millisecond * 10)
+				_, err := q.TryDequeue()
+				assert.NoError(t, err)
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, q.Enqueue(ctx, 2))
+		})
+	}
+}
+
+func TestBlockingQueue_TryAfterClose(t *testing.T) {
+	for name, newQueue := range queuesWith[closableBlockingQueue](t, 2, abilityBlocking|abilityClose) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			require.NoError(t, q.TryEnqueue(1))
+			q.Close()
+			assert.Equal(t, ErrQueueClosed, q.TryEnqueue(2))
+			val, err := q.TryDequeue()
+			require.NoError(t, err)
+			assert.Equal(t, 1, val)
+			_, err = q.TryDequeue()
+			assert.Equal(t, ErrQueueClosed, err)
+		})
+	}
+}
+
+func TestBlockingQueue_TryEnqueueZeroCapacity(t *testing.T) {
+	for _, f := range queueFixtures {
+		if f.abilities&abilityBlocking == 0 {
+			continue
+		}
+		t.Run(f.name, func(t *testing.T) {
+			q := f.newQueue(0).(BlockingQueue[int])
+			err := q.TryEnqueue(1)
+			if !f.boundless {
+				// 容量为 0 的时候永远也放不下
+				assert.Equal(t, ErrOutOfCapacity, err)
+				assert.Equal(t, 0, q.Len())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, q.Len())
+		})
+	}
+}
+
+func TestBlockingQueue_Cap(t *testing.T) {
+	for _, f := range queueFixtures {
+		if f.abilities&abilityBlocking == 0 || !f.boundless {
+			continue
+		}
+		t.Run(f.name, func(t *testing.T) {
+			assert.Equal(t, 0, f.newQueue(0).(BlockingQueue[int]).Cap())
+		})
+	}
+}
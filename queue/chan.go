@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// chanRequeueTimeout ToChan 退出的时候，把手上的元素放回队列最多等待多久
+const chanRequeueTimeout = time.Second
+
+// ToChan 把队列转换成 channel，后台 goroutine 不断地从 q 出队，然后发送到返回的 channel
+// 1. 没有人读取 channel 的时候，后台 goroutine 阻塞在发送上，不会继续出队，buffer 控制最多预取多少个元素
+// 2. ctx 过期或者出队返回错误的时候，后台 goroutine 退出并关闭 channel，
+// 错误会发送到第二个 channel，例如 ctx.Err() 或者 ErrQueueClosed
+// 3. 退出的时候已经出队但是还没有发送出去的那个元素会通过 Enqueue 重新放回队列，
+// 所以对于 FIFO 的队列，它会排到后面去。放回失败的话，发送到第二个 channel 的是 *UndeliveredError，
+// 里面带着这个元素，可以由调用方自己处理。已经在 channel 缓冲里的元素依旧可以读出来
+func ToChan[T any](ctx context.Context, q Queue[T], buffer int) (<-chan T, <-chan error) {
+	ch := make(chan T, buffer)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(ch)
+		for {
+			val, err := q.Dequeue(ctx)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case ch <- val:
+			case <-ctx.Done():
+				errCh <- requeue(ctx, q, val)
+				return
+			}
+		}
+	}()
+	return ch, errCh
+}
+
+// UndeliveredError ToChan 退出的时候，已经出队但是既没有发送出去，也没能放回队列的元素
+type UndeliveredError[T any] struct {
+	Val T
+	// Err 包含 ToChan 退出的原因和放回队列失败的原因
+	Err error
+}
+
+func (u *UndeliveredError[T]) Error() string {
+	return fmt.Sprintf("go_utils: 元素没能放回队列: %v", u.Err)
+}
+
+func (u *UndeliveredError[T]) Unwrap() error {
+	return u.Err
+}
+
+// requeue 把已经出队的元素放回去，返回需要发送给调用方的错误
+// ctx 已经过期了，所以用一个新的超时时间
+func requeue[T any](ctx context.Context, q Queue[T], val T) error {
+	rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), chanRequeueTimeout)
+	defer cancel()
+	if err := q.Enqueue(rctx, val); err != nil {
+		return &UndeliveredError[T]{Val: val, Err: errors.Join(ctx.Err(), err)}
+	}
+	return ctx.Err()
+}
+
+// FromChan 后台 goroutine 不断地从 ch 读取元素，然后放入 q
+// 1. 队列满了的时候阻塞在入队上，不会继续读取 ch，上游的发送方也会被阻塞住
+// 2. ch 被关闭并且所有元素都入队之后，后台 goroutine 退出，返回的 channel 被关闭
+// 3. ctx 过期或者入队返回错误的时候，后台 goroutine 退出，错误会发送到返回的 channel，
+// 这时候正在入队的那个元素会丢失，ch 里剩下的元素不会被读取
+func FromChan[T any](ctx context.Context, ch <-chan T, q Queue[T]) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		for {
+			select {
+			case val, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := q.Enqueue(ctx, val); err != nil {
+					errCh <- err
+					return
+				}
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return errCh
+}
@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToChan(t *testing.T) {
+	q := NewConcurrentLinkedBlockingQueue[int](0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, q.Enqueue(ctx, i))
+	}
+	ch, errCh := ToChan[int](ctx, q, 0)
+	assert.Equal(t, 1, <-ch)
+
+	// 没有人读取的时候，后台 goroutine 最多拿走一个元素
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, []int{3}, q.AsSlice())
+
+	// 后面入队的元素也能读出来
+	assert.Equal(t, 2, <-ch)
+	assert.Equal(t, 3, <-ch)
+	require.NoError(t, q.Enqueue(ctx, 4))
+	assert.Equal(t, 4, <-ch)
+
+	// 退出的时候把手上的元素放回去
+	require.NoError(t, q.Enqueue(ctx, 5))
+	time.Sleep(time.Millisecond * 10)
+	cancel()
+	assert.Equal(t, context.Canceled, <-errCh)
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, []int{5}, q.AsSlice())
+}
+
+func TestToChan_Buffer(t *testing.T) {
+	q := NewConcurrentArrayBlockingQueue[int](5)
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, q.Enqueue(ctx, i))
+	}
+	ch, errCh := ToChan[int](ctx, q, 2)
+	// 缓冲两个，手上拿着一个
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, 2, q.Len())
+	cancel()
+	assert.Equal(t, context.Canceled, <-errCh)
+	// 缓冲里的元素依旧可以读出来
+	var vals []int
+	for val := range ch {
+		vals = append(vals, val)
+	}
+	assert.Equal(t, []int{1, 2}, vals)
+	assert.Equal(t, 3, q.Len())
+}
+
+func TestToChan_Undelivered(t *testing.T) {
+	q := NewConcurrentLinkedBlockingQueue[int](0)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, q.Enqueue(ctx, 1))
+	ch, errCh := ToChan[int](ctx, q, 0)
+	// 手上拿着一个，但是队列已经关闭了，放不回去
+	time.Sleep(time.Millisecond * 10)
+	q.Close()
+	cancel()
+	err := <-errCh
+	var undelivered *UndeliveredError[int]
+	require.True(t, errors.As(err, &undelivered))
+	assert.Equal(t, 1, undelivered.Val)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, errors.Is(err, ErrQueueClosed))
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestToChan_DequeueError(t *testing.T) {
+	wantErr := errors.New("mock error")
+	ch, errCh := ToChan[int](context.Background(), errQueue[int]{err: wantErr}, 0)
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, wantErr, <-errCh)
+}
+
+func TestFromChan(t *testing.T) {
+	q := NewConcurrentArrayBlockingQueue[int](1)
+	ch := make(chan int)
+	errCh := FromChan[int](context.Background(), ch, q)
+	ch <- 1
+	// 后台 goroutine 拿到 2 之后阻塞在入队上，不会再读取 ch
+	ch <- 2
+	select {
+	case ch <- 3:
+		t.Fatal("不应该能发送成功")
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	go func() {
+		for i := 3; i <= 5; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 1; i <= 5; i++ {
+		val, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, i, val)
+	}
+	// ch 关闭之后正常退出
+	err, ok := <-errCh
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestFromChan_Cancel(t *testing.T) {
+	testCases := []struct {
+		name string
+		q    Queue[int]
+		// 取消之前发送的元素
+		vals []int
+	}{
+		{
+			// 阻塞在读取 ch 上
+			name: "waiting for chan",
+			q:    NewConcurrentArrayBlockingQueue[int](1),
+		},
+		{
+			// 阻塞在入队上
+			name: "waiting for enqueue",
+			q:    NewConcurrentArrayBlockingQueue[int](1),
+			vals: []int{1, 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := make(chan int)
+			errCh := FromChan[int](ctx, ch, tc.q)
+			for _, val := range tc.vals {
+				ch <- val
+			}
+			cancel()
+			assert.Equal(t, context.Canceled, <-errCh)
+		})
+	}
+
+	t.Run("enqueue error", func(t *testing.T) {
+		wantErr := errors.New("mock error")
+		ch := make(chan int, 1)
+		ch <- 1
+		errCh := FromChan[int](context.Background(), ch, errQueue[int]{err: wantErr})
+		assert.Equal(t, wantErr, <-errCh)
+	})
+}
+
+// errQueue 入队出队都返回错误
+type errQueue[T any] struct {
+	err error
+}
+
+func (e errQueue[T]) Enqueue(ctx context.Context, val T) error {
+	return e.err
+}
+
+func (e errQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	var t T
+	return t, e.err
+}
@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue_Close(t *testing.T) {
+	for name, newQueue := range queuesWith[closableQueue](t, 3, abilityClose) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, q.Enqueue(ctx, 1))
+			require.NoError(t, q.Enqueue(ctx, 2))
+			q.Close()
+			// 重复关闭
+			q.Close()
+			assert.Equal(t, ErrQueueClosed, q.Enqueue(ctx, 3))
+
+			// 取完剩下的元素之后返回 ErrQueueClosed
+			for _, want := range []int{1, 2} {
+				val, err := q.Dequeue(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, want, val)
+			}
+			_, err := q.Dequeue(ctx)
+			assert.Equal(t, ErrQueueClosed, err)
+		})
+	}
+}
+
+func TestQueue_CloseWakeUp(t *testing.T) {
+	for name, newQueue := range queuesWith[closableQueue](t, 1, abilityClose) {
+		t.Run(name+" blocked enqueue", func(t *testing.T) {
+			q := newQueue()
+			require.NoError(t, q.Enqueue(context.Background(), 1))
+			errCh := make(chan error)
+			go func() {
+				errCh <- q.Enqueue(context.Background(), 2)
+			}()
+			time.Sleep(time.Millisecond * 10)
+			q.Close()
+			assert.Equal(t, ErrQueueClosed, <-errCh)
+			val, err := q.Dequeue(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, val)
+		})
+
+		t.Run(name+" blocked dequeue", func(t *testing.T) {
+			q := newQueue()
+			errCh := make(chan error)
+			for i := 0; i < 3; i++ {
+				go func() {
+					_, err := q.Dequeue(context.Background())
+					errCh <- err
+				}()
+			}
+			time.Sleep(time.Millisecond * 10)
+			q.Close()
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, ErrQueueClosed, <-errCh)
+			}
+		})
+	}
+}
+
+func TestQueue_CloseAndDrain(t *testing.T) {
+	for name, newQueue := range queuesWith[closableQueue](t, 5, abilityClose) {
+		t.Run(name+" drained by consumer", func(t *testing.T) {
+			q := newQueue()
+			for i := 1; i <= 3; i++ {
+				require.NoError(t, q.Enqueue(context.Background(), i))
+			}
+			res := make(chan []int)
+			go func() {
+				var vals []int
+				for {
+					val, err := q.Dequeue(context.Background())
+					if err != nil {
+						assert.Equal(t, ErrQueueClosed, err)
+						res <- vals
+						return
+					}
+					vals = append(vals, val)
+					time.Sleep(time.Millisecond * 5)
+				}
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			assert.Empty(t, q.CloseAndDrain(ctx))
+			assert.Equal(t, []int{1, 2, 3}, <-res)
+		})
+
+		t.Run(name+" leftovers", func(t *testing.T) {
+			q := newQueue()
+			for i := 1; i <= 3; i++ {
+				require.NoError(t, q.Enqueue(context.Background(), i))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+			defer cancel()
+			assert.Equal(t, []int{1, 2, 3}, q.CloseAndDrain(ctx))
+			_, err := q.Dequeue(context.Background())
+			assert.Equal(t, ErrQueueClosed, err)
+		})
+	}
+}
+
+func TestBatchQueue_Close(t *testing.T) {
+	for name, newQueue := range queuesWith[closableBatchQueue](t, 3, abilityBatch|abilityClose) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, q.EnqueueBatch(ctx, []int{1, 2}))
+
+			// 空间不够阻塞住的批量入队被唤醒
+			errCh := make(chan error)
+			go func() {
+				errCh <- q.EnqueueBatch(ctx, []int{3, 4})
+			}()
+			time.Sleep(time.Millisecond * 10)
+			q.Close()
+			assert.Equal(t, ErrQueueClosed, <-errCh)
+
+			// 关闭之后不再等待凑满
+			vals, err := q.DequeueBatch(ctx, 3, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 2}, vals)
+			_, err = q.DequeueBatch(ctx, 3, time.Second)
+			assert.Equal(t, ErrQueueClosed, err)
+		})
+	}
+}
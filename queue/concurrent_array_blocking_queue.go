@@ -3,9 +3,13 @@ package queue
 import (
 	"context"
 	"sync"
+	"time"
 )
 
-var _ Queue[any] = &ConcurrentArrayBlockingQueue[any]{}
+var (
+	_ BatchQueue[any]    = &ConcurrentArrayBlockingQueue[any]{}
+	_ BlockingQueue[any] = &ConcurrentArrayBlockingQueue[any]{}
+)
 
 type ConcurrentArrayBlockingQueue[T any] struct {
 	data []T
@@ -37,7 +41,7 @@ func (c *ConcurrentArrayBlockingQueue[T]) Dequeue(ctx context.Context) (T, error
 	}
 	c.mutex.Lock()
 	// 这里使用for，因为唤醒之后获取到锁这段过程中，队列可能又为空了
-	for c.size == 0 {
+	for c.size == 0 && !c.readCond.closed {
 		ch := c.readCond.signalCh()
 		select {
 		case <-ctx.Done():
@@ -47,16 +51,13 @@ func (c *ConcurrentArrayBlockingQueue[T]) Dequeue(ctx context.Context) (T, error
 			c.mutex.Lock()
 		}
 	}
-	res := c.data[c.head]
-	var t T
-	// 为了释放内存，GC
-	c.data[c.head] = t
-
-	c.head++
-	c.size--
-	if c.head == cap(c.data) {
-		c.head = 0
+	if c.size == 0 {
+		// 已经关闭并且取完了
+		c.mutex.Unlock()
+		var t T
+		return t, ErrQueueClosed
 	}
+	res := c.pop()
 	c.writeCond.broadcast()
 	return res, nil
 }
@@ -66,7 +67,7 @@ func (c *ConcurrentArrayBlockingQueue[T]) Enqueue(ctx context.Context, val T) er
 		return ctx.Err()
 	}
 	c.mutex.Lock()
-	for c.size == len(c.data) {
+	for c.size == len(c.data) && !c.writeCond.closed {
 		// 注意：这里接下来要进行睡眠，因此里面会把锁释放
 		ch := c.writeCond.signalCh()
 		select {
@@ -76,6 +77,75 @@ func (c *ConcurrentArrayBlockingQueue[T]) Enqueue(ctx context.Context, val T) er
 			c.mutex.Lock()
 		}
 	}
+	if c.writeCond.closed {
+		c.mutex.Unlock()
+		return ErrQueueClosed
+	}
+	c.push(val)
+	c.readCond.broadcast()
+	return nil
+}
+
+// TryEnqueue 不阻塞地入队，队列满了返回 ErrOutOfCapacity
+func (c *ConcurrentArrayBlockingQueue[T]) TryEnqueue(val T) error {
+	return tryEnqueue[T](c.mutex, c.readCond, c.writeCond, c, val)
+}
+
+// TryDequeue 不阻塞地出队，队列为空返回 ErrEmptyQueue
+func (c *ConcurrentArrayBlockingQueue[T]) TryDequeue() (T, error) {
+	return tryDequeue[T](c.mutex, c.readCond, c.writeCond, c)
+}
+
+// Peek 查看队首元素，队列为空返回 ErrEmptyQueue
+func (c *ConcurrentArrayBlockingQueue[T]) Peek() (T, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.size == 0 {
+		var t T
+		return t, ErrEmptyQueue
+	}
+	return c.data[c.head], nil
+}
+
+func (c *ConcurrentArrayBlockingQueue[T]) EnqueueBatch(ctx context.Context, vals []T) error {
+	return enqueueBatch[T](ctx, c.mutex, c.readCond, c.writeCond, c, vals)
+}
+
+func (c *ConcurrentArrayBlockingQueue[T]) DequeueBatch(ctx context.Context, max int, maxWait time.Duration) ([]T, error) {
+	return dequeueBatch[T](ctx, c.mutex, c.readCond, c.writeCond, c, max, maxWait)
+}
+
+func (c *ConcurrentArrayBlockingQueue[T]) DrainTo(dst []T) []T {
+	return drainTo[T](c.mutex, c.writeCond, c, dst)
+}
+
+// Close 关闭队列，之后入队返回 ErrQueueClosed，阻塞的入队也会被唤醒并返回 ErrQueueClosed
+// 出队可以继续取走剩下的元素，取完之后返回 ErrQueueClosed
+// 重复关闭不会有任何效果
+func (c *ConcurrentArrayBlockingQueue[T]) Close() {
+	closeQueue(c.mutex, c.readCond, c.writeCond)
+}
+
+// CloseAndDrain 关闭队列，然后等待消费者取完剩下的元素
+// ctx 过期的时候还没有被取走的元素会被全部取出来返回
+func (c *ConcurrentArrayBlockingQueue[T]) CloseAndDrain(ctx context.Context) []T {
+	return closeAndDrain[T](ctx, c.mutex, c.readCond, c.writeCond, c)
+}
+
+func (c *ConcurrentArrayBlockingQueue[T]) length() int {
+	return c.size
+}
+
+// bounded 数组实现总是有界的，容量为 0 的队列永远也放不下元素
+func (c *ConcurrentArrayBlockingQueue[T]) bounded() bool {
+	return true
+}
+
+func (c *ConcurrentArrayBlockingQueue[T]) capacity() int {
+	return len(c.data)
+}
+
+func (c *ConcurrentArrayBlockingQueue[T]) push(val T) {
 	c.data[c.tail] = val
 	c.tail++
 	c.size++
@@ -84,9 +154,20 @@ func (c *ConcurrentArrayBlockingQueue[T]) Enqueue(ctx context.Context, val T) er
 	if c.tail == cap(c.data) {
 		c.tail = 0
 	}
+}
 
-	c.readCond.broadcast()
-	return nil
+func (c *ConcurrentArrayBlockingQueue[T]) pop() T {
+	res := c.data[c.head]
+	var t T
+	// 为了释放内存，GC
+	c.data[c.head] = t
+
+	c.head++
+	c.size--
+	if c.head == cap(c.data) {
+		c.head = 0
+	}
+	return res
 }
 
 func (c *ConcurrentArrayBlockingQueue[T]) AsSlice() []T {
@@ -108,3 +189,8 @@ func (c *ConcurrentArrayBlockingQueue[T]) Len() int {
 	defer c.mutex.RUnlock()
 	return c.size
 }
+
+// Cap 创建队列时设置的容量
+func (c *ConcurrentArrayBlockingQueue[T]) Cap() int {
+	return len(c.data)
+}
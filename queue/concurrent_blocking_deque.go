@@ -0,0 +1,309 @@
+package queue
+
+import (
+	"context"
+	"go_utils/list"
+	"sync"
+)
+
+var (
+	_ Deque[any] = &ConcurrentBlockingDeque[any]{}
+	_ Queue[any] = &ConcurrentBlockingDeque[any]{}
+)
+
+// arrayDequeMinSize 数组实现的初始大小，容量不够的时候翻倍
+const arrayDequeMinSize = 16
+
+// ConcurrentBlockingDeque 并发阻塞双端队列
+// 适合工作窃取：自己从一端 PushBack 和 PopBack，空闲的 goroutine 从另一端 PopFront
+// 作为 Queue 使用的时候，Enqueue 等于 PushBack，Dequeue 等于 PopFront
+type ConcurrentBlockingDeque[T any] struct {
+	mu      *sync.RWMutex
+	maxSize int
+	data    unsafeDeque[T]
+
+	readCond  *cond
+	writeCond *cond
+}
+
+// NewConcurrentArrayBlockingDeque 创建基于环形数组的阻塞双端队列，capacity <= 0 时为无界队列
+// 数组按需扩容，不会一开始就分配 capacity 大小的空间
+func NewConcurrentArrayBlockingDeque[T any](capacity int) *ConcurrentBlockingDeque[T] {
+	return newConcurrentBlockingDeque[T](capacity, newArrayDeque[T](capacity))
+}
+
+// NewConcurrentLinkedBlockingDeque 创建基于链表的阻塞双端队列，capacity <= 0 时为无界队列
+func NewConcurrentLinkedBlockingDeque[T any](capacity int) *ConcurrentBlockingDeque[T] {
+	return newConcurrentBlockingDeque[T](capacity, &linkedDeque[T]{list: list.NewLinkedList[T]()})
+}
+
+func newConcurrentBlockingDeque[T any](capacity int, data unsafeDeque[T]) *ConcurrentBlockingDeque[T] {
+	mu := &sync.RWMutex{}
+	return &ConcurrentBlockingDeque[T]{
+		mu:        mu,
+		maxSize:   capacity,
+		data:      data,
+		readCond:  newCond(mu),
+		writeCond: newCond(mu),
+	}
+}
+
+func (c *ConcurrentBlockingDeque[T]) Enqueue(ctx context.Context, val T) error {
+	return c.PushBack(ctx, val)
+}
+
+func (c *ConcurrentBlockingDeque[T]) Dequeue(ctx context.Context) (T, error) {
+	return c.PopFront(ctx)
+}
+
+// PushFront 从队首入队，队列满了的时候阻塞
+func (c *ConcurrentBlockingDeque[T]) PushFront(ctx context.Context, val T) error {
+	return c.push(ctx, val, true)
+}
+
+// PushBack 从队尾入队，队列满了的时候阻塞
+func (c *ConcurrentBlockingDeque[T]) PushBack(ctx context.Context, val T) error {
+	return c.push(ctx, val, false)
+}
+
+// PopFront 从队首出队，队列为空的时候阻塞
+func (c *ConcurrentBlockingDeque[T]) PopFront(ctx context.Context) (T, error) {
+	return c.pop(ctx, true)
+}
+
+// PopBack 从队尾出队，队列为空的时候阻塞
+func (c *ConcurrentBlockingDeque[T]) PopBack(ctx context.Context) (T, error) {
+	return c.pop(ctx, false)
+}
+
+func (c *ConcurrentBlockingDeque[T]) push(ctx context.Context, val T, front bool) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	for c.maxSize > 0 && c.data.length() == c.maxSize && !c.writeCond.closed {
+		ch := c.writeCond.signalCh()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			c.mu.Lock()
+		}
+	}
+	if c.writeCond.closed {
+		c.mu.Unlock()
+		return ErrQueueClosed
+	}
+	if front {
+		c.data.pushFront(val)
+	} else {
+		c.data.pushBack(val)
+	}
+	// 这里会释放锁
+	c.readCond.broadcast()
+	return nil
+}
+
+func (c *ConcurrentBlockingDeque[T]) pop(ctx context.Context, front bool) (T, error) {
+	if ctx.Err() != nil {
+		var t T
+		return t, ctx.Err()
+	}
+	c.mu.Lock()
+	for c.data.length() == 0 && !c.readCond.closed {
+		ch := c.readCond.signalCh()
+		select {
+		case <-ctx.Done():
+			var t T
+			return t, ctx.Err()
+		case <-ch:
+			c.mu.Lock()
+		}
+	}
+	if c.data.length() == 0 {
+		// 已经关闭并且取完了
+		c.mu.Unlock()
+		var t T
+		return t, ErrQueueClosed
+	}
+	var val T
+	if front {
+		val = c.data.popFront()
+	} else {
+		val = c.data.popBack()
+	}
+	c.writeCond.broadcast()
+	return val, nil
+}
+
+// Close 关闭队列，之后两端入队都返回 ErrQueueClosed，阻塞的入队也会被唤醒并返回 ErrQueueClosed
+// 两端出队可以继续取走剩下的元素，取完之后返回 ErrQueueClosed
+// 重复关闭不会有任何效果
+func (c *ConcurrentBlockingDeque[T]) Close() {
+	closeQueue(c.mu, c.readCond, c.writeCond)
+}
+
+// CloseAndDrain 关闭队列，然后等待消费者取完剩下的元素
+// ctx 过期的时候还没有被取走的元素会按照从队首到队尾的顺序全部取出来返回
+func (c *ConcurrentBlockingDeque[T]) CloseAndDrain(ctx context.Context) []T {
+	return closeAndDrain[T](ctx, c.mu, c.readCond, c.writeCond, dequeQueue[T]{unsafeDeque: c.data, maxSize: c.maxSize})
+}
+
+func (c *ConcurrentBlockingDeque[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.data.length()
+}
+
+// AsSlice 从队首到队尾的所有元素
+func (c *ConcurrentBlockingDeque[T]) AsSlice() []T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.data.asSlice()
+}
+
+// unsafeDeque 不加锁的双端队列，由 ConcurrentBlockingDeque 负责加锁和阻塞
+type unsafeDeque[T any] interface {
+	length() int
+	pushFront(val T)
+	pushBack(val T)
+	// popFront 调用方保证队列不为空
+	popFront() T
+	// popBack 调用方保证队列不为空
+	popBack() T
+	asSlice() []T
+}
+
+// dequeQueue 把 unsafeDeque 当成队尾入队、队首出队的 unsafeQueue，用来复用关闭的逻辑
+type dequeQueue[T any] struct {
+	unsafeDeque[T]
+	maxSize int
+}
+
+func (d dequeQueue[T]) bounded() bool {
+	return d.maxSize > 0
+}
+
+func (d dequeQueue[T]) capacity() int {
+	return d.maxSize
+}
+
+func (d dequeQueue[T]) push(val T) {
+	d.pushBack(val)
+}
+
+func (d dequeQueue[T]) pop() T {
+	return d.popFront()
+}
+
+// arrayDeque 环形数组，满了之后扩容为原来的两倍，有界的时候不会超过 capacity
+type arrayDeque[T any] struct {
+	data []T
+	head int
+	size int
+	// capacity <= 0 表示无界
+	capacity int
+}
+
+func newArrayDeque[T any](capacity int) *arrayDeque[T] {
+	size := arrayDequeMinSize
+	if capacity > 0 {
+		size = min(size, capacity)
+	}
+	return &arrayDeque[T]{
+		data:     make([]T, size),
+		capacity: capacity,
+	}
+}
+
+func (a *arrayDeque[T]) length() int {
+	return a.size
+}
+
+func (a *arrayDeque[T]) pushFront(val T) {
+	a.grow()
+	a.head = (a.head - 1 + len(a.data)) % len(a.data)
+	a.data[a.head] = val
+	a.size++
+}
+
+func (a *arrayDeque[T]) pushBack(val T) {
+	a.grow()
+	a.data[(a.head+a.size)%len(a.data)] = val
+	a.size++
+}
+
+func (a *arrayDeque[T]) popFront() T {
+	var zero T
+	val := a.data[a.head]
+	// 释放引用，方便垃圾回收
+	a.data[a.head] = zero
+	a.head = (a.head + 1) % len(a.data)
+	a.size--
+	return val
+}
+
+func (a *arrayDeque[T]) popBack() T {
+	var zero T
+	tail := (a.head + a.size - 1) % len(a.data)
+	val := a.data[tail]
+	a.data[tail] = zero
+	a.size--
+	return val
+}
+
+func (a *arrayDeque[T]) asSlice() []T {
+	res := make([]T, a.size)
+	// 从 head 到数组末尾，以及绕回来的部分
+	n := copy(res, a.data[a.head:min(a.head+a.size, len(a.data))])
+	copy(res[n:], a.data[:a.size-n])
+	return res
+}
+
+// grow 数组满了的时候扩容，并且把元素从头开始排好
+func (a *arrayDeque[T]) grow() {
+	if a.size < len(a.data) {
+		return
+	}
+	newSize := len(a.data) * 2
+	if a.capacity > 0 {
+		newSize = min(newSize, a.capacity)
+	}
+	data := make([]T, newSize)
+	copy(data, a.asSlice())
+	a.data = data
+	a.head = 0
+}
+
+// linkedDeque 基于 list.LinkedList，两端的操作都是 O(1) 的
+type linkedDeque[T any] struct {
+	list *list.LinkedList[T]
+}
+
+func (l *linkedDeque[T]) length() int {
+	return l.list.Len()
+}
+
+func (l *linkedDeque[T]) pushFront(val T) {
+	// 在头部插入不会失败
+	_ = l.list.Add(0, val)
+}
+
+func (l *linkedDeque[T]) pushBack(val T) {
+	_ = l.list.Append(val)
+}
+
+func (l *linkedDeque[T]) popFront() T {
+	// 调用方保证了链表不为空，删除不会失败
+	val, _ := l.list.Delete(0)
+	return val
+}
+
+func (l *linkedDeque[T]) popBack() T {
+	val, _ := l.list.Delete(l.list.Len() - 1)
+	return val
+}
+
+func (l *linkedDeque[T]) asSlice() []T {
+	return l.list.AsSlice()
+}
@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentBlockingDeque_PushPop(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 对队列进行的操作
+		ops func(t *testing.T, q *ConcurrentBlockingDeque[int]) []int
+
+		wantVals  []int
+		wantSlice []int
+	}{
+		{
+			name: "push back pop front",
+			ops: func(t *testing.T, q *ConcurrentBlockingDeque[int]) []int {
+				pushBack(t, q, 1, 2, 3)
+				return popN(t, q, true, 3)
+			},
+			wantVals:  []int{1, 2, 3},
+			wantSlice: []int{},
+		},
+		{
+			name: "push back pop back",
+			ops: func(t *testing.T, q *ConcurrentBlockingDeque[int]) []int {
+				pushBack(t, q, 1, 2, 3)
+				return popN(t, q, false, 2)
+			},
+			wantVals:  []int{3, 2},
+			wantSlice: []int{1},
+		},
+		{
+			name: "push front",
+			ops: func(t *testing.T, q *ConcurrentBlockingDeque[int]) []int {
+				pushFront(t, q, 1, 2, 3)
+				pushBack(t, q, 4)
+				return popN(t, q, true, 1)
+			},
+			wantVals:  []int{3},
+			wantSlice: []int{2, 1, 4},
+		},
+		{
+			// 数组环绕以及扩容
+			name: "wrap around and grow",
+			ops: func(t *testing.T, q *ConcurrentBlockingDeque[int]) []int {
+				for i := 1; i <= 20; i++ {
+					pushFront(t, q, -i)
+					pushBack(t, q, i)
+				}
+				res := popN(t, q, true, 18)
+				return append(res, popN(t, q, false, 18)...)
+			},
+			wantVals: []int{-20, -19, -18, -17, -16, -15, -14, -13, -12, -11, -10, -9, -8, -7, -6, -5, -4, -3,
+				20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3},
+			wantSlice: []int{-2, -1, 1, 2},
+		},
+	}
+	for name, newDeque := range queuesWith[*ConcurrentBlockingDeque[int]](t, 0, abilityDeque) {
+		for _, tc := range testCases {
+			t.Run(name+" "+tc.name, func(t *testing.T) {
+				q := newDeque()
+				assert.Equal(t, tc.wantVals, tc.ops(t, q))
+				assert.Equal(t, tc.wantSlice, q.AsSlice())
+				assert.Equal(t, len(tc.wantSlice), q.Len())
+			})
+		}
+	}
+}
+
+func TestConcurrentBlockingDeque_Blocking(t *testing.T) {
+	for name, newDeque := range queuesWith[*ConcurrentBlockingDeque[int]](t, 2, abilityDeque) {
+		t.Run(name, func(t *testing.T) {
+			q := newDeque()
+			// 队列为空，出队超时
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+			defer cancel()
+			_, err := q.PopFront(ctx)
+			assert.Equal(t, context.DeadlineExceeded, err)
+			_, err = q.PopBack(ctx)
+			assert.Equal(t, context.DeadlineExceeded, err)
+
+			// 队列满了，入队超时
+			pushBack(t, q, 1, 2)
+			ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*10)
+			defer cancel()
+			assert.Equal(t, context.DeadlineExceeded, q.PushFront(ctx, 3))
+			assert.Equal(t, context.DeadlineExceeded, q.PushBack(ctx, 3))
+			assert.Equal(t, []int{1, 2}, q.AsSlice())
+
+			// 出队之后唤醒入队
+			go func() {
+				time.Sleep(time.Millisecond * 10)
+				_, err := q.PopBack(context.Background())
+				assert.NoError(t, err)
+			}()
+			ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, q.PushFront(ctx, 0))
+			assert.Equal(t, []int{0, 1}, q.AsSlice())
+
+			// 入队之后唤醒出队
+			popN(t, q, true, 2)
+			go func() {
+				time.Sleep(time.Millisecond * 10)
+				assert.NoError(t, q.Enqueue(context.Background(), 4))
+			}()
+			val, err := q.Dequeue(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 4, val)
+		})
+	}
+}
+
+func TestConcurrentBlockingDeque_Close(t *testing.T) {
+	for name, newDeque := range queuesWith[*ConcurrentBlockingDeque[int]](t, 2, abilityDeque|abilityClose) {
+		t.Run(name, func(t *testing.T) {
+			q := newDeque()
+			pushBack(t, q, 1, 2)
+			// 队首阻塞的入队被唤醒
+			errCh := make(chan error)
+			go func() {
+				errCh <- q.PushFront(context.Background(), 0)
+			}()
+			time.Sleep(time.Millisecond * 10)
+			q.Close()
+			assert.Equal(t, ErrQueueClosed, <-errCh)
+			assert.Equal(t, ErrQueueClosed, q.PushFront(context.Background(), 0))
+			assert.Equal(t, ErrQueueClosed, q.PushBack(context.Background(), 3))
+
+			// 两端都可以取走剩下的元素，取完之后返回 ErrQueueClosed
+			assert.Equal(t, []int{2}, popN(t, q, false, 1))
+			assert.Equal(t, []int{1}, popN(t, q, true, 1))
+			_, err := q.PopBack(context.Background())
+			assert.Equal(t, ErrQueueClosed, err)
+			_, err = q.PopFront(context.Background())
+			assert.Equal(t, ErrQueueClosed, err)
+		})
+	}
+}
+
+func TestConcurrentBlockingDeque_WorkStealing(t *testing.T) {
+	for name, newDeque := range queuesWith[*ConcurrentBlockingDeque[int]](t, 0, abilityDeque) {
+		t.Run(name, func(t *testing.T) {
+			q := newDeque()
+			const n = 1000
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			var mu sync.Mutex
+			seen := make(map[int]struct{}, n)
+			record := func(val int) {
+				mu.Lock()
+				defer mu.Unlock()
+				_, ok := seen[val]
+				assert.False(t, ok)
+				seen[val] = struct{}{}
+			}
+			var wg sync.WaitGroup
+			// 拥有者从队尾入队和出队
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					require.NoError(t, q.PushBack(ctx, i))
+					if i%2 == 0 {
+						val, err := q.PopBack(ctx)
+						require.NoError(t, err)
+						record(val)
+					}
+				}
+			}()
+			// 其它 goroutine 从队首窃取
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						mu.Lock()
+						done := len(seen) == n
+						mu.Unlock()
+						if done {
+							return
+						}
+						sctx, scancel := context.WithTimeout(ctx, time.Millisecond*10)
+						val, err := q.PopFront(sctx)
+						scancel()
+						if err == nil {
+							record(val)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, n, len(seen))
+			assert.Equal(t, 0, q.Len())
+		})
+	}
+}
+
+func pushBack(t *testing.T, q *ConcurrentBlockingDeque[int], vals ...int) {
+	for _, val := range vals {
+		require.NoError(t, q.PushBack(context.Background(), val))
+	}
+}
+
+func pushFront(t *testing.T, q *ConcurrentBlockingDeque[int], vals ...int) {
+	for _, val := range vals {
+		require.NoError(t, q.PushFront(context.Background(), val))
+	}
+}
+
+func popN(t *testing.T, q *ConcurrentBlockingDeque[int], front bool, n int) []int {
+	res := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		var val int
+		var err error
+		if front {
+			val, err = q.PopFront(context.Background())
+		} else {
+			val, err = q.PopBack(context.Background())
+		}
+		require.NoError(t, err)
+		res = append(res, val)
+	}
+	return res
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"go_utils/list"
 	"sync"
+	"time"
 )
 
-var _ Queue[any] = &ConcurrentLinkedBlockingQueue[any]{}
+var (
+	_ BatchQueue[any]    = &ConcurrentLinkedBlockingQueue[any]{}
+	_ BlockingQueue[any] = &ConcurrentLinkedBlockingQueue[any]{}
+)
 
 type ConcurrentLinkedBlockingQueue[T any] struct {
 	mu *sync.RWMutex
@@ -36,6 +40,11 @@ func (c *ConcurrentLinkedBlockingQueue[T]) Len() int {
 	return c.linkedList.Len()
 }
 
+// Cap 无界队列返回0，有界队列返回创建队列时设置的值
+func (c *ConcurrentLinkedBlockingQueue[T]) Cap() int {
+	return max(c.maxSize, 0)
+}
+
 func (c *ConcurrentLinkedBlockingQueue[T]) AsSlice() []T {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -48,7 +57,7 @@ func (c *ConcurrentLinkedBlockingQueue[T]) Enqueue(ctx context.Context, val T) e
 		return ctx.Err()
 	}
 	c.mu.Lock()
-	for c.maxSize > 0 && c.linkedList.Len() == c.maxSize {
+	for c.maxSize > 0 && c.linkedList.Len() == c.maxSize && !c.writeCond.closed {
 		ch := c.writeCond.signalCh()
 		select {
 		case <-ctx.Done():
@@ -57,6 +66,10 @@ func (c *ConcurrentLinkedBlockingQueue[T]) Enqueue(ctx context.Context, val T) e
 			c.mu.Lock()
 		}
 	}
+	if c.writeCond.closed {
+		c.mu.Unlock()
+		return ErrQueueClosed
+	}
 
 	err := c.linkedList.Append(val)
 	if err != nil {
@@ -74,7 +87,7 @@ func (c *ConcurrentLinkedBlockingQueue[T]) Dequeue(ctx context.Context) (T, erro
 		return t, ctx.Err()
 	}
 	c.mu.Lock()
-	for c.linkedList.Len() == 0 {
+	for c.linkedList.Len() == 0 && !c.readCond.closed {
 		signal := c.readCond.signalCh()
 		select {
 		case <-ctx.Done():
@@ -84,8 +97,84 @@ func (c *ConcurrentLinkedBlockingQueue[T]) Dequeue(ctx context.Context) (T, erro
 			c.mu.Lock()
 		}
 	}
+	if c.linkedList.Len() == 0 {
+		// 已经关闭并且取完了
+		c.mu.Unlock()
+		var t T
+		return t, ErrQueueClosed
+	}
 
 	val, err := c.linkedList.Delete(0)
 	c.writeCond.broadcast()
 	return val, err
 }
+
+// TryEnqueue 不阻塞地入队，队列满了返回 ErrOutOfCapacity
+func (c *ConcurrentLinkedBlockingQueue[T]) TryEnqueue(val T) error {
+	return tryEnqueue[T](c.mu, c.readCond, c.writeCond, c, val)
+}
+
+// TryDequeue 不阻塞地出队，队列为空返回 ErrEmptyQueue
+func (c *ConcurrentLinkedBlockingQueue[T]) TryDequeue() (T, error) {
+	return tryDequeue[T](c.mu, c.readCond, c.writeCond, c)
+}
+
+// Peek 查看队首元素，队列为空返回 ErrEmptyQueue
+func (c *ConcurrentLinkedBlockingQueue[T]) Peek() (T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.linkedList.Len() == 0 {
+		var t T
+		return t, ErrEmptyQueue
+	}
+	// 取链表头部是 O(1) 的
+	return c.linkedList.Get(0)
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) EnqueueBatch(ctx context.Context, vals []T) error {
+	return enqueueBatch[T](ctx, c.mu, c.readCond, c.writeCond, c, vals)
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) DequeueBatch(ctx context.Context, max int, maxWait time.Duration) ([]T, error) {
+	return dequeueBatch[T](ctx, c.mu, c.readCond, c.writeCond, c, max, maxWait)
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) DrainTo(dst []T) []T {
+	return drainTo[T](c.mu, c.writeCond, c, dst)
+}
+
+// Close 关闭队列，之后入队返回 ErrQueueClosed，阻塞的入队也会被唤醒并返回 ErrQueueClosed
+// 出队可以继续取走剩下的元素，取完之后返回 ErrQueueClosed
+// 重复关闭不会有任何效果
+func (c *ConcurrentLinkedBlockingQueue[T]) Close() {
+	closeQueue(c.mu, c.readCond, c.writeCond)
+}
+
+// CloseAndDrain 关闭队列，然后等待消费者取完剩下的元素
+// ctx 过期的时候还没有被取走的元素会被全部取出来返回
+func (c *ConcurrentLinkedBlockingQueue[T]) CloseAndDrain(ctx context.Context) []T {
+	return closeAndDrain[T](ctx, c.mu, c.readCond, c.writeCond, c)
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) length() int {
+	return c.linkedList.Len()
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) bounded() bool {
+	return c.maxSize > 0
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) capacity() int {
+	return c.maxSize
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) push(val T) {
+	// 在尾部追加不会失败
+	_ = c.linkedList.Append(val)
+}
+
+func (c *ConcurrentLinkedBlockingQueue[T]) pop() T {
+	// 调用方保证了链表不为空，删除头部不会失败
+	val, _ := c.linkedList.Delete(0)
+	return val
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	_ BatchQueue[any]    = &ConcurrentPriorityBlockingQueue[any]{}
+	_ BlockingQueue[any] = &ConcurrentPriorityBlockingQueue[any]{}
+)
+
+// ConcurrentPriorityBlockingQueue 并发安全的阻塞优先队列，每次出队的都是 compare 意义下最小的元素
+// 队列为空的时候 Dequeue 阻塞，队列满了的时候 Enqueue 阻塞，直到条件满足或者 ctx 过期
+type ConcurrentPriorityBlockingQueue[T any] struct {
+	queue *PriorityQueue[T]
+
+	mutex     *sync.RWMutex
+	readCond  *cond
+	writeCond *cond
+}
+
+// NewConcurrentPriorityBlockingQueue 创建阻塞优先队列 capacity <= 0 时，为无界队列
+func NewConcurrentPriorityBlockingQueue[T any](capacity int, compare Comparator[T]) *ConcurrentPriorityBlockingQueue[T] {
+	mu := &sync.RWMutex{}
+	return &ConcurrentPriorityBlockingQueue[T]{
+		queue:     NewPriorityQueue[T](capacity, compare),
+		mutex:     mu,
+		readCond:  newCond(mu),
+		writeCond: newCond(mu),
+	}
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) Enqueue(ctx context.Context, val T) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	c.mutex.Lock()
+	for c.queue.isFull() && !c.writeCond.closed {
+		// 注意：这里接下来要进行睡眠，因此里面会把锁释放
+		ch := c.writeCond.signalCh()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			c.mutex.Lock()
+		}
+	}
+	if c.writeCond.closed {
+		c.mutex.Unlock()
+		return ErrQueueClosed
+	}
+	c.push(val)
+	c.readCond.broadcast()
+	return nil
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	if ctx.Err() != nil {
+		var t T
+		return t, ctx.Err()
+	}
+	c.mutex.Lock()
+	// 这里使用for，因为唤醒之后获取到锁这段过程中，队列可能又为空了
+	for c.queue.isEmpty() && !c.readCond.closed {
+		ch := c.readCond.signalCh()
+		select {
+		case <-ctx.Done():
+			var t T
+			return t, ctx.Err()
+		case <-ch:
+			c.mutex.Lock()
+		}
+	}
+	if c.queue.isEmpty() {
+		// 已经关闭并且取完了
+		c.mutex.Unlock()
+		var t T
+		return t, ErrQueueClosed
+	}
+	res := c.pop()
+	c.writeCond.broadcast()
+	return res, nil
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.queue.Len()
+}
+
+// Cap 无界队列返回0，有界队列返回创建队列时设置的值
+func (c *ConcurrentPriorityBlockingQueue[T]) Cap() int {
+	return c.queue.Cap()
+}
+
+// TryEnqueue 不阻塞地入队，队列满了返回 ErrOutOfCapacity
+func (c *ConcurrentPriorityBlockingQueue[T]) TryEnqueue(val T) error {
+	return tryEnqueue[T](c.mutex, c.readCond, c.writeCond, c, val)
+}
+
+// TryDequeue 不阻塞地出队，队列为空返回 ErrEmptyQueue
+func (c *ConcurrentPriorityBlockingQueue[T]) TryDequeue() (T, error) {
+	return tryDequeue[T](c.mutex, c.readCond, c.writeCond, c)
+}
+
+// Peek 查看优先级最高的元素，队列为空返回 ErrEmptyQueue
+func (c *ConcurrentPriorityBlockingQueue[T]) Peek() (T, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.queue.Peek()
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) EnqueueBatch(ctx context.Context, vals []T) error {
+	return enqueueBatch[T](ctx, c.mutex, c.readCond, c.writeCond, c, vals)
+}
+
+// DequeueBatch 批量出队，返回的元素按照优先级从高到低排列
+func (c *ConcurrentPriorityBlockingQueue[T]) DequeueBatch(ctx context.Context, max int, maxWait time.Duration) ([]T, error) {
+	return dequeueBatch[T](ctx, c.mutex, c.readCond, c.writeCond, c, max, maxWait)
+}
+
+// DrainTo 取出所有元素，按照优先级从高到低追加到 dst 后面
+func (c *ConcurrentPriorityBlockingQueue[T]) DrainTo(dst []T) []T {
+	return drainTo[T](c.mutex, c.writeCond, c, dst)
+}
+
+// Close 关闭队列，之后入队返回 ErrQueueClosed，阻塞的入队也会被唤醒并返回 ErrQueueClosed
+// 出队可以继续按照优先级取走剩下的元素，取完之后返回 ErrQueueClosed
+// 重复关闭不会有任何效果
+func (c *ConcurrentPriorityBlockingQueue[T]) Close() {
+	closeQueue(c.mutex, c.readCond, c.writeCond)
+}
+
+// CloseAndDrain 关闭队列，然后等待消费者取完剩下的元素
+// ctx 过期的时候还没有被取走的元素会被全部取出来返回
+func (c *ConcurrentPriorityBlockingQueue[T]) CloseAndDrain(ctx context.Context) []T {
+	return closeAndDrain[T](ctx, c.mutex, c.readCond, c.writeCond, c)
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) length() int {
+	return c.queue.Len()
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) bounded() bool {
+	return !c.queue.IsBoundless()
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) capacity() int {
+	return c.queue.Cap()
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) push(val T) {
+	// 调用方保证了队列没满，这里不会返回错误
+	_ = c.queue.Enqueue(context.Background(), val)
+}
+
+func (c *ConcurrentPriorityBlockingQueue[T]) pop() T {
+	// 调用方保证了队列不为空，这里不会返回错误
+	res, _ := c.queue.Dequeue(context.Background())
+	return res
+}
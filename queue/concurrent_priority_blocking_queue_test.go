@@ -0,0 +1,231 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentPriorityBlockingQueue_Enqueue(t *testing.T) {
+	testCases := []struct {
+		name    string
+		q       func() *ConcurrentPriorityBlockingQueue[int]
+		val     int
+		timeout time.Duration
+
+		wantErr error
+		wantLen int
+		// 依次出队的结果
+		wantVals []int
+	}{
+		{
+			name: "empty and enqueued",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				return NewConcurrentPriorityBlockingQueue[int](3, compare())
+			},
+			val:      123,
+			timeout:  time.Second,
+			wantLen:  1,
+			wantVals: []int{123},
+		},
+		{
+			name: "invalid context",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				return NewConcurrentPriorityBlockingQueue[int](3, compare())
+			},
+			val:     123,
+			timeout: -time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "enqueued with priority",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				q := NewConcurrentPriorityBlockingQueue[int](3, compare())
+				require.NoError(t, q.Enqueue(context.Background(), 345))
+				require.NoError(t, q.Enqueue(context.Background(), 123))
+				return q
+			},
+			val:      234,
+			timeout:  time.Second,
+			wantLen:  3,
+			wantVals: []int{123, 234, 345},
+		},
+		{
+			name: "full timeout",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				q := NewConcurrentPriorityBlockingQueue[int](2, compare())
+				require.NoError(t, q.Enqueue(context.Background(), 345))
+				require.NoError(t, q.Enqueue(context.Background(), 123))
+				return q
+			},
+			val:      234,
+			timeout:  time.Millisecond * 10,
+			wantErr:  context.DeadlineExceeded,
+			wantLen:  2,
+			wantVals: []int{123, 345},
+		},
+		{
+			name: "boundless",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				q := NewConcurrentPriorityBlockingQueue[int](0, compare())
+				for i := 100; i > 0; i-- {
+					require.NoError(t, q.Enqueue(context.Background(), i))
+				}
+				return q
+			},
+			val:      0,
+			timeout:  time.Second,
+			wantLen:  101,
+			wantVals: []int{0, 1, 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err := q.Enqueue(ctx, tc.val)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantLen, q.Len())
+			for _, want := range tc.wantVals {
+				val, err := q.Dequeue(context.Background())
+				require.NoError(t, err)
+				assert.Equal(t, want, val)
+			}
+		})
+	}
+
+	t.Run("enqueue after dequeue", func(t *testing.T) {
+		q := NewConcurrentPriorityBlockingQueue[int](1, compare())
+		require.NoError(t, q.Enqueue(context.Background(), 123))
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			val, err := q.Dequeue(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 123, val)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, q.Enqueue(ctx, 234))
+		assert.Equal(t, 1, q.Len())
+	})
+}
+
+func TestConcurrentPriorityBlockingQueue_Dequeue(t *testing.T) {
+	testCases := []struct {
+		name    string
+		q       func() *ConcurrentPriorityBlockingQueue[int]
+		timeout time.Duration
+
+		wantErr error
+		wantVal int
+		wantLen int
+	}{
+		{
+			name: "dequeued",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				q := NewConcurrentPriorityBlockingQueue[int](3, compare())
+				require.NoError(t, q.Enqueue(context.Background(), 234))
+				require.NoError(t, q.Enqueue(context.Background(), 123))
+				return q
+			},
+			timeout: time.Second,
+			wantVal: 123,
+			wantLen: 1,
+		},
+		{
+			name: "invalid context",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				q := NewConcurrentPriorityBlockingQueue[int](3, compare())
+				require.NoError(t, q.Enqueue(context.Background(), 123))
+				return q
+			},
+			timeout: -time.Second,
+			wantErr: context.DeadlineExceeded,
+			wantLen: 1,
+		},
+		{
+			name: "empty timeout",
+			q: func() *ConcurrentPriorityBlockingQueue[int] {
+				return NewConcurrentPriorityBlockingQueue[int](3, compare())
+			},
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			val, err := q.Dequeue(ctx)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVal, val)
+			assert.Equal(t, tc.wantLen, q.Len())
+		})
+	}
+
+	t.Run("dequeue after enqueue", func(t *testing.T) {
+		q := NewConcurrentPriorityBlockingQueue[int](3, compare())
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			require.NoError(t, q.Enqueue(context.Background(), 123))
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		val, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 123, val)
+	})
+}
+
+func TestConcurrentPriorityBlockingQueue(t *testing.T) {
+	// 并发测试，只是测试有没有死锁之类的问题
+	// 优先级这个特性依赖于其它单元测试
+	q := NewConcurrentPriorityBlockingQueue[int](100, compare())
+	var wg sync.WaitGroup
+	wg.Add(1000)
+	for i := 0; i < 1000; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			val := rand.Int()
+			err := q.Enqueue(ctx, val)
+			cancel()
+			require.NoError(t, err)
+		}()
+	}
+	go func() {
+		for i := 0; i < 1000; i++ {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				_, err := q.Dequeue(ctx)
+				cancel()
+				require.NoError(t, err)
+				wg.Done()
+			}()
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, 0, q.Len())
+}
+
+func ExampleNewConcurrentPriorityBlockingQueue() {
+	// 创建一个容量为 10 的有界阻塞优先队列，如果传入 0 或者负数，那么创建的是无界阻塞优先队列
+	q := NewConcurrentPriorityBlockingQueue[int](10, ComparatorRealNumber[int])
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = q.Enqueue(ctx, 33)
+	_ = q.Enqueue(ctx, 22)
+	val, err := q.Dequeue(ctx)
+	if err != nil {
+		return
+	}
+	fmt.Println(val)
+	// Output:
+	// 22
+}
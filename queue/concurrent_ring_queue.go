@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"context"
+	"math/bits"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+var _ Queue[any] = &ConcurrentRingQueue[any]{}
+
+const (
+	// ringSpinCnt 阻塞操作先让出 CPU 的次数，超过之后才开始睡眠
+	ringSpinCnt = 16
+	// ringMaxBackoff 阻塞操作单次睡眠的上限，同时也是最坏情况下的唤醒延迟
+	ringMaxBackoff = time.Millisecond
+)
+
+// ConcurrentRingQueue 无锁的有界多生产者多消费者队列
+// 基于 Dmitry Vyukov 的环形队列：每个槽位带一个序号，生产者和消费者各自通过 CAS 抢占位置，
+// 抢到之后通过槽位的序号交接数据，整个过程不需要锁
+// 和 ConcurrentArrayBlockingQueue 相比，高并发下吞吐量更高，代价是：
+// 1. 容量会被向上取整到 2 的幂，并且最小为 2
+// 2. 阻塞的 Enqueue 和 Dequeue 是通过退避轮询实现的，唤醒会有最多 1 毫秒的延迟
+type ConcurrentRingQueue[T any] struct {
+	// 生产者和消费者的位置放在不同的缓存行，避免伪共享
+	_          [64]byte
+	enqueuePos atomic.Uint64
+	_          [56]byte
+	dequeuePos atomic.Uint64
+	_          [56]byte
+
+	mask  uint64
+	cells []ringCell[T]
+}
+
+type ringCell[T any] struct {
+	// seq == pos 表示可以写入第 pos 个元素
+	// seq == pos + 1 表示第 pos 个元素已经写入，可以读取
+	seq atomic.Uint64
+	val T
+}
+
+// NewConcurrentRingQueue 创建无锁队列，capacity 会被向上取整到 2 的幂，并且最小为 2
+// 只有一个槽位的时候，"第 pos 个元素可读"和"第 pos+1 个元素可写"的序号相同，无法区分
+func NewConcurrentRingQueue[T any](capacity int) *ConcurrentRingQueue[T] {
+	size := uint64(2)
+	if capacity > 2 {
+		size = 1 << bits.Len64(uint64(capacity-1))
+	}
+	cells := make([]ringCell[T], size)
+	for i := range cells {
+		cells[i].seq.Store(uint64(i))
+	}
+	return &ConcurrentRingQueue[T]{
+		mask:  size - 1,
+		cells: cells,
+	}
+}
+
+// TryEnqueue 尝试入队，不会阻塞，队列满了返回 ErrOutOfCapacity
+func (q *ConcurrentRingQueue[T]) TryEnqueue(val T) error {
+	pos := q.enqueuePos.Load()
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := cell.seq.Load()
+		diff := int64(seq - pos)
+		switch {
+		case diff == 0:
+			if q.enqueuePos.CompareAndSwap(pos, pos+1) {
+				cell.val = val
+				// 发布数据，消费者看到序号之后才会读取 val
+				cell.seq.Store(pos + 1)
+				return nil
+			}
+		case diff < 0:
+			// 这个槽位上一轮的数据还没有被消费
+			return ErrOutOfCapacity
+		}
+		// 被别的生产者抢先了，重新读取位置
+		pos = q.enqueuePos.Load()
+	}
+}
+
+// TryDequeue 尝试出队，不会阻塞，队列为空返回 ErrEmptyQueue
+func (q *ConcurrentRingQueue[T]) TryDequeue() (T, error) {
+	pos := q.dequeuePos.Load()
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := cell.seq.Load()
+		diff := int64(seq - (pos + 1))
+		switch {
+		case diff == 0:
+			if q.dequeuePos.CompareAndSwap(pos, pos+1) {
+				res := cell.val
+				// 为了释放内存，GC
+				var t T
+				cell.val = t
+				// 把槽位交给下一轮的生产者
+				cell.seq.Store(pos + q.mask + 1)
+				return res, nil
+			}
+		case diff < 0:
+			// 这个槽位还没有写入数据
+			var t T
+			return t, ErrEmptyQueue
+		}
+		pos = q.dequeuePos.Load()
+	}
+}
+
+// Enqueue 入队，队列满了的时候阻塞，直到有空位或者 ctx 过期
+func (q *ConcurrentRingQueue[T]) Enqueue(ctx context.Context, val T) error {
+	var b ringBackoff
+	defer b.stop()
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if q.TryEnqueue(val) == nil {
+			return nil
+		}
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Dequeue 出队，队列为空的时候阻塞，直到有数据或者 ctx 过期
+func (q *ConcurrentRingQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	var b ringBackoff
+	defer b.stop()
+	for {
+		if ctx.Err() != nil {
+			var t T
+			return t, ctx.Err()
+		}
+		if res, err := q.TryDequeue(); err == nil {
+			return res, nil
+		}
+		if err := b.wait(ctx); err != nil {
+			var t T
+			return t, err
+		}
+	}
+}
+
+// Len 返回队列中元素的数量
+// 并发读写的时候只是一个近似值
+func (q *ConcurrentRingQueue[T]) Len() int {
+	for {
+		tail := q.enqueuePos.Load()
+		head := q.dequeuePos.Load()
+		// 两次读取之间生产者的位置没有变化，才能保证 head <= tail
+		if tail == q.enqueuePos.Load() {
+			return int(min(tail-head, q.mask+1))
+		}
+	}
+}
+
+// Cap 返回队列的容量，即向上取整之后的值
+func (q *ConcurrentRingQueue[T]) Cap() int {
+	return len(q.cells)
+}
+
+// ringBackoff 阻塞操作的退避策略
+// 先让出 CPU 若干次，之后按照指数增长的间隔睡眠，直到 ringMaxBackoff
+type ringBackoff struct {
+	cnt   int
+	timer *time.Timer
+}
+
+func (b *ringBackoff) wait(ctx context.Context) error {
+	b.cnt++
+	if b.cnt <= ringSpinCnt {
+		runtime.Gosched()
+		return nil
+	}
+	interval := min(time.Microsecond<<min(b.cnt-ringSpinCnt, 10), ringMaxBackoff)
+	if b.timer == nil {
+		b.timer = time.NewTimer(interval)
+	} else {
+		b.timer.Reset(interval)
+	}
+	select {
+	case <-b.timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *ringBackoff) stop() {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
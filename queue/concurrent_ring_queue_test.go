@@ -0,0 +1,383 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewConcurrentRingQueue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capacity int
+		wantCap  int
+	}{
+		{name: "negative", capacity: -1, wantCap: 2},
+		{name: "zero", capacity: 0, wantCap: 2},
+		{name: "one", capacity: 1, wantCap: 2},
+		{name: "three", capacity: 3, wantCap: 4},
+		{name: "power of two", capacity: 8, wantCap: 8},
+		{name: "round up", capacity: 9, wantCap: 16},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewConcurrentRingQueue[int](tc.capacity)
+			assert.Equal(t, tc.wantCap, q.Cap())
+			assert.Equal(t, 0, q.Len())
+		})
+	}
+}
+
+func TestConcurrentRingQueue_TryEnqueue(t *testing.T) {
+	testCases := []struct {
+		name string
+		q    func() *ConcurrentRingQueue[int]
+		val  int
+
+		wantErr error
+		wantLen int
+	}{
+		{
+			name: "empty and enqueued",
+			q: func() *ConcurrentRingQueue[int] {
+				return NewConcurrentRingQueue[int](2)
+			},
+			val:     123,
+			wantLen: 1,
+		},
+		{
+			name: "enqueued full",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				return q
+			},
+			val:     234,
+			wantLen: 2,
+		},
+		{
+			name: "full",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				require.NoError(t, q.TryEnqueue(234))
+				return q
+			},
+			val:     345,
+			wantErr: ErrOutOfCapacity,
+			wantLen: 2,
+		},
+		{
+			// 绕了一圈之后重新使用第一个槽位
+			name: "wrap around",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				require.NoError(t, q.TryEnqueue(234))
+				_, err := q.TryDequeue()
+				require.NoError(t, err)
+				return q
+			},
+			val:     345,
+			wantLen: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			err := q.TryEnqueue(tc.val)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantLen, q.Len())
+		})
+	}
+}
+
+func TestConcurrentRingQueue_TryDequeue(t *testing.T) {
+	testCases := []struct {
+		name string
+		q    func() *ConcurrentRingQueue[int]
+
+		wantErr error
+		wantVal int
+		wantLen int
+	}{
+		{
+			name: "empty",
+			q: func() *ConcurrentRingQueue[int] {
+				return NewConcurrentRingQueue[int](2)
+			},
+			wantErr: ErrEmptyQueue,
+		},
+		{
+			name: "dequeued",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				require.NoError(t, q.TryEnqueue(234))
+				return q
+			},
+			wantVal: 123,
+			wantLen: 1,
+		},
+		{
+			name: "wrap around",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				require.NoError(t, q.TryEnqueue(234))
+				_, err := q.TryDequeue()
+				require.NoError(t, err)
+				_, err = q.TryDequeue()
+				require.NoError(t, err)
+				require.NoError(t, q.TryEnqueue(345))
+				return q
+			},
+			wantVal: 345,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			val, err := q.TryDequeue()
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVal, val)
+			assert.Equal(t, tc.wantLen, q.Len())
+		})
+	}
+}
+
+func TestConcurrentRingQueue_Enqueue(t *testing.T) {
+	testCases := []struct {
+		name    string
+		q       func() *ConcurrentRingQueue[int]
+		timeout time.Duration
+
+		wantErr error
+		wantLen int
+	}{
+		{
+			name: "enqueued",
+			q: func() *ConcurrentRingQueue[int] {
+				return NewConcurrentRingQueue[int](2)
+			},
+			timeout: time.Second,
+			wantLen: 1,
+		},
+		{
+			name: "invalid context",
+			q: func() *ConcurrentRingQueue[int] {
+				return NewConcurrentRingQueue[int](2)
+			},
+			timeout: -time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "full timeout",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				require.NoError(t, q.TryEnqueue(234))
+				return q
+			},
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+			wantLen: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err := q.Enqueue(ctx, 234)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantLen, q.Len())
+		})
+	}
+
+	t.Run("enqueue after dequeue", func(t *testing.T) {
+		q := NewConcurrentRingQueue[int](2)
+		require.NoError(t, q.TryEnqueue(123))
+		require.NoError(t, q.TryEnqueue(123))
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			val, err := q.TryDequeue()
+			require.NoError(t, err)
+			require.Equal(t, 123, val)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, q.Enqueue(ctx, 234))
+		assert.Equal(t, 2, q.Len())
+	})
+}
+
+func TestConcurrentRingQueue_Dequeue(t *testing.T) {
+	testCases := []struct {
+		name    string
+		q       func() *ConcurrentRingQueue[int]
+		timeout time.Duration
+
+		wantErr error
+		wantVal int
+	}{
+		{
+			name: "dequeued",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				return q
+			},
+			timeout: time.Second,
+			wantVal: 123,
+		},
+		{
+			name: "invalid context",
+			q: func() *ConcurrentRingQueue[int] {
+				q := NewConcurrentRingQueue[int](2)
+				require.NoError(t, q.TryEnqueue(123))
+				return q
+			},
+			timeout: -time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "empty timeout",
+			q: func() *ConcurrentRingQueue[int] {
+				return NewConcurrentRingQueue[int](2)
+			},
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q()
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			val, err := q.Dequeue(ctx)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+
+	t.Run("dequeue after enqueue", func(t *testing.T) {
+		q := NewConcurrentRingQueue[int](2)
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			require.NoError(t, q.TryEnqueue(123))
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		val, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 123, val)
+	})
+}
+
+func TestConcurrentRingQueue(t *testing.T) {
+	// 并发测试，每个元素都必须恰好被消费一次
+	q := NewConcurrentRingQueue[int](16)
+	const producers, cnt = 8, 1000
+	var sum atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(producers * 2)
+	for i := 0; i < producers; i++ {
+		go func(base int) {
+			defer wg.Done()
+			for j := 1; j <= cnt; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				err := q.Enqueue(ctx, base*cnt+j)
+				cancel()
+				require.NoError(t, err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < cnt; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				val, err := q.Dequeue(ctx)
+				cancel()
+				require.NoError(t, err)
+				sum.Add(int64(val))
+			}
+		}()
+	}
+	wg.Wait()
+	n := int64(producers * cnt)
+	assert.Equal(t, n*(n+1)/2, sum.Load())
+	assert.Equal(t, 0, q.Len())
+}
+
+// go test -benchmem -bench BenchmarkQueue -cpu="2,4,8,16" .
+// 多个生产者和消费者同时读写容量为 64 的队列，每个 op 表示一个元素从入队到出队
+func BenchmarkQueue(b *testing.B) {
+	testCases := []struct {
+		name string
+		q    func() Queue[int]
+	}{
+		{
+			name: "ring",
+			q: func() Queue[int] {
+				return NewConcurrentRingQueue[int](64)
+			},
+		},
+		{
+			name: "array",
+			q: func() Queue[int] {
+				return NewConcurrentArrayBlockingQueue[int](64)
+			},
+		},
+		{
+			name: "linked",
+			q: func() Queue[int] {
+				return NewConcurrentLinkedBlockingQueue[int](64)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		for _, workers := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("%s/workers-%d", tc.name, workers), func(b *testing.B) {
+				benchmarkQueue(b, tc.q(), workers)
+			})
+		}
+	}
+}
+
+func benchmarkQueue(b *testing.B, q Queue[int], workers int) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	wg.Add(workers * 2)
+	b.ResetTimer()
+	for i := 0; i < workers; i++ {
+		// 把 b.N 个元素尽量平均地分给每个生产者和消费者
+		n := b.N / workers
+		if i < b.N%workers {
+			n++
+		}
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				if err := q.Enqueue(ctx, j); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				if _, err := q.Dequeue(ctx); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"math"
 	"sync"
 	"time"
 )
@@ -12,8 +13,13 @@ type Delayable interface {
 	Deadline() time.Time
 }
 
+var (
+	_ BlockingQueue[Delayable] = &DelayQueue[Delayable]{}
+	_ BatchQueue[Delayable]    = &DelayQueue[Delayable]{}
+)
+
 type DelayQueue[T Delayable] struct {
-	queue     *PriorityQueue[T]
+	queue     *IndexedPriorityQueue[T]
 	lock      *sync.Mutex
 	readCond  *cond
 	writeCond *cond
@@ -22,7 +28,7 @@ type DelayQueue[T Delayable] struct {
 
 // NewDelayQueue 新建一个延时队列，当size<=0时，表示无界
 func NewDelayQueue[T Delayable](size int) *DelayQueue[T] {
-	queue := NewPriorityQueue[T](size, func(src T, dst T) int {
+	queue := NewIndexedPriorityQueue[T](size, func(src T, dst T) int {
 		srcDeadline := src.Deadline()
 		dstDeadline := dst.Deadline()
 		// peak的时候，队首为最小的（小顶堆）
@@ -34,6 +40,8 @@ func NewDelayQueue[T Delayable](size int) *DelayQueue[T] {
 		return 0
 	})
 	lock := &sync.Mutex{}
+	// 句柄可能在锁外面被读取
+	queue.mu = lock
 	return &DelayQueue[T]{
 		queue:     queue,
 		lock:      lock,
@@ -44,36 +52,287 @@ func NewDelayQueue[T Delayable](size int) *DelayQueue[T] {
 
 // Enqueue 入队操作
 func (d *DelayQueue[T]) Enqueue(ctx context.Context, val T) error {
+	_, err := d.EnqueueWithHandle(ctx, val)
+	return err
+}
+
+// EnqueueWithHandle 入队并返回句柄，可以用来取消或者修改还没有出队的元素
+func (d *DelayQueue[T]) EnqueueWithHandle(ctx context.Context, val T) (*Handle[T], error) {
 	d.lock.Lock()
 	for {
 		if ctx.Err() != nil {
 			d.lock.Unlock()
-			return ctx.Err()
+			return nil, ctx.Err()
+		}
+		if d.writeCond.closed {
+			d.lock.Unlock()
+			return nil, ErrQueueClosed
 		}
-		err := d.queue.Enqueue(ctx, val)
+		h, err := d.queue.EnqueueWithHandle(ctx, val)
 		switch err {
 		case nil:
 			// 唤醒所有的读等待，开始进行接收
 			// 注意：里面会有释放锁的操作
 			d.readCond.broadcast()
-			return err
+			return h, err
 		case ErrOutOfCapacity:
 			// 注意：里面会进行解锁操作，主要这里是防止自己既在阻塞，又拿着锁不释放
 			ch := d.writeCond.signalCh()
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return nil, ctx.Err()
 			case <-ch:
 				d.lock.Lock()
 			}
 		default:
 			// 进行解锁操作，不应该占用着锁
 			d.lock.Unlock()
-			return err
+			return nil, err
 		}
 	}
 }
 
+// TryEnqueue 不阻塞地入队，队列满了返回 ErrOutOfCapacity
+func (d *DelayQueue[T]) TryEnqueue(val T) error {
+	d.lock.Lock()
+	if d.writeCond.closed {
+		d.lock.Unlock()
+		return ErrQueueClosed
+	}
+	if err := d.queue.Enqueue(context.Background(), val); err != nil {
+		d.lock.Unlock()
+		return err
+	}
+	d.readCond.broadcast()
+	return nil
+}
+
+// TryDequeue 不阻塞地出队，没有到期的元素返回 ErrEmptyQueue
+func (d *DelayQueue[T]) TryDequeue() (T, error) {
+	d.lock.Lock()
+	data, err := d.queue.Peek()
+	if err != nil {
+		closed := d.readCond.closed
+		d.lock.Unlock()
+		if closed {
+			return d.zero, ErrQueueClosed
+		}
+		return d.zero, ErrEmptyQueue
+	}
+	if !time.Now().After(data.Deadline()) {
+		d.lock.Unlock()
+		return d.zero, ErrEmptyQueue
+	}
+	data, err = d.queue.Dequeue(context.Background())
+	d.writeCond.broadcast()
+	return data, err
+}
+
+// Peek 查看最早到期的元素，不管有没有到期，队列为空返回 ErrEmptyQueue
+func (d *DelayQueue[T]) Peek() (T, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.queue.Peek()
+}
+
+// EnqueueBatch 批量入队，要么全部入队，要么全部不入队
+func (d *DelayQueue[T]) EnqueueBatch(ctx context.Context, vals []T) error {
+	return enqueueBatch[T](ctx, d.lock, d.readCond, d.writeCond, d, vals)
+}
+
+// DequeueBatch 批量出队，只会返回已经到期的元素
+// 没有到期的元素的时候阻塞，直到有元素到期或者 ctx 过期
+// 拿到第一个元素之后，最多再等待 maxWait，期间到期的元素也会被凑进来
+func (d *DelayQueue[T]) DequeueBatch(ctx context.Context, max int, maxWait time.Duration) ([]T, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if max <= 0 {
+		return []T{}, nil
+	}
+	res := make([]T, 0, min(max, 64))
+	// 凑批的截止时间，从拿到第一个元素开始计时
+	var batchDeadline time.Time
+	d.lock.Lock()
+	for {
+		now := time.Now()
+		n := len(res)
+		res = d.popExpired(res, max, now)
+		if n == 0 && len(res) > 0 {
+			batchDeadline = now.Add(maxWait)
+		}
+		if len(res) == max || (len(res) > 0 && !now.Before(batchDeadline)) {
+			if len(res) > n {
+				d.writeCond.broadcast()
+			} else {
+				d.lock.Unlock()
+			}
+			return res, nil
+		}
+		if len(res) > n {
+			// 先唤醒等待写入的人，腾出来的位置才能被利用上
+			d.writeCond.broadcast()
+			d.lock.Lock()
+			continue
+		}
+		if d.queue.isEmpty() && d.readCond.closed {
+			// 已经关闭并且取完了，不会再有新元素了
+			d.lock.Unlock()
+			if len(res) > 0 {
+				return res, nil
+			}
+			return nil, ErrQueueClosed
+		}
+		// 等到队首到期，或者凑批的截止时间，以先到的为准
+		wait := time.Duration(-1)
+		if head, err := d.queue.Peek(); err == nil {
+			wait = head.Deadline().Sub(now)
+		}
+		if len(res) > 0 && (wait < 0 || batchDeadline.Sub(now) < wait) {
+			wait = batchDeadline.Sub(now)
+		}
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		ch := d.readCond.signalCh()
+		select {
+		case <-ch:
+			// 有新元素进来了，或者队首被删除、修改了
+		case <-timeout:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			if len(res) > 0 {
+				return res, nil
+			}
+			return nil, ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		d.lock.Lock()
+	}
+}
+
+// DrainTo 不阻塞地取出所有已经到期的元素，追加到 dst 后面并返回
+func (d *DelayQueue[T]) DrainTo(dst []T) []T {
+	d.lock.Lock()
+	n := len(dst)
+	dst = d.popExpired(dst, math.MaxInt, time.Now())
+	if len(dst) == n {
+		d.lock.Unlock()
+		return dst
+	}
+	d.writeCond.broadcast()
+	return dst
+}
+
+// popExpired 取出已经到期的元素追加到 dst 后面，dst 最多 max 个元素，必须在锁范围内调用
+func (d *DelayQueue[T]) popExpired(dst []T, max int, now time.Time) []T {
+	for len(dst) < max {
+		head, err := d.queue.Peek()
+		if err != nil || !now.After(head.Deadline()) {
+			break
+		}
+		dst = append(dst, d.pop())
+	}
+	return dst
+}
+
+func (d *DelayQueue[T]) Len() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.queue.Len()
+}
+
+// Cap 无界队列返回0，有界队列返回创建队列时设置的值
+func (d *DelayQueue[T]) Cap() int {
+	return d.queue.Cap()
+}
+
+// Contains 元素是否还在队列里，出队或者被删除之后返回 false
+func (d *DelayQueue[T]) Contains(h *Handle[T]) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.queue.Contains(h)
+}
+
+// Remove 删除还没有出队的元素，元素已经出队或者被删除的时候返回 false
+func (d *DelayQueue[T]) Remove(h *Handle[T]) bool {
+	d.lock.Lock()
+	isHead := d.queue.Contains(h) && h.index == 1
+	if !d.queue.Remove(h) {
+		d.lock.Unlock()
+		return false
+	}
+	// 腾出了空间，唤醒等待入队的
+	d.writeCond.broadcast()
+	if isHead {
+		// 队首变了，等待出队的要重新计算等待时间
+		d.lock.Lock()
+		d.readCond.broadcast()
+	}
+	return true
+}
+
+// Update 修改还没有出队的元素，例如推迟或者提前到期时间
+// 元素已经出队或者被删除的时候返回 false
+func (d *DelayQueue[T]) Update(h *Handle[T], val T) bool {
+	d.lock.Lock()
+	isHead := d.queue.Contains(h) && h.index == 1
+	if !d.queue.Update(h, val) {
+		d.lock.Unlock()
+		return false
+	}
+	if isHead || h.index == 1 {
+		// 队首变了，或者队首的到期时间变了，等待出队的要重新计算等待时间
+		d.readCond.broadcast()
+		return true
+	}
+	d.lock.Unlock()
+	return true
+}
+
+// Close 关闭队列，之后入队返回 ErrQueueClosed，阻塞的入队也会被唤醒并返回 ErrQueueClosed
+// 出队依旧会按照到期时间取走剩下的元素，取完之后返回 ErrQueueClosed
+// 重复关闭不会有任何效果
+func (d *DelayQueue[T]) Close() {
+	closeQueue(d.lock, d.readCond, d.writeCond)
+}
+
+// CloseAndDrain 关闭队列，然后等待消费者取完剩下的元素
+// ctx 过期的时候还没有被取走的元素会被全部取出来返回，不管有没有到期
+func (d *DelayQueue[T]) CloseAndDrain(ctx context.Context) []T {
+	return closeAndDrain[T](ctx, d.lock, d.readCond, d.writeCond, d)
+}
+
+func (d *DelayQueue[T]) length() int {
+	return d.queue.Len()
+}
+
+func (d *DelayQueue[T]) bounded() bool {
+	return d.queue.Cap() > 0
+}
+
+func (d *DelayQueue[T]) capacity() int {
+	return d.queue.Cap()
+}
+
+func (d *DelayQueue[T]) push(val T) {
+	// 调用方保证了队列没满，这里不会返回错误
+	_ = d.queue.Enqueue(context.Background(), val)
+}
+
+func (d *DelayQueue[T]) pop() T {
+	// 调用方保证了队列不为空，这里不会返回错误
+	res, _ := d.queue.Dequeue(context.Background())
+	return res
+}
+
 // Dequeue 出队操作
 // 1. 先检测队列有没有元素，没有要阻塞，直到超时，或者拿到元素
 // 2. 有元素，你是不是要看一眼，队头的元素的过期时间有没有到
@@ -90,6 +349,11 @@ func (d *DelayQueue[T]) Dequeue(ctx context.Context) (T, error) {
 		}
 		d.lock.Lock()
 		if d.queue.isEmpty() {
+			if d.readCond.closed {
+				// 已经关闭并且取完了
+				d.lock.Unlock()
+				return d.zero, ErrQueueClosed
+			}
 			ch := d.readCond.signalCh()
 			select {
 			case <-ch:
@@ -106,17 +370,19 @@ func (d *DelayQueue[T]) Dequeue(ctx context.Context) (T, error) {
 				return data, err
 			}
 			// 此时当前元素还未到达超时时间
-			ticker := time.NewTicker(data.Deadline().Sub(now))
+			timer := time.NewTimer(data.Deadline().Sub(now))
 			// 调用signalCh
 			// 1. 这里要进行释放锁，以免下面占用着锁，又在超时等待
 			// 2. 需要获取channel进行阻塞，以便有新元素来了可以被进行唤醒通知
 			ch := d.readCond.signalCh()
 			select {
 			case <-ctx.Done():
+				timer.Stop()
 				return d.zero, ctx.Err()
-			case <-ticker.C:
+			case <-timer.C:
 			case <-ch:
-				// 说明此时有新元素进来了
+				// 说明此时有新元素进来了，或者队首被删除、修改了
+				timer.Stop()
 			}
 		}
 	}
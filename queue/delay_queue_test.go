@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
+	"sync"
 	"testing"
 	"time"
 )
@@ -277,6 +278,213 @@ func TestDelayQueue_Enqueue(t *testing.T) {
 	})
 }
 
+func TestDelayQueue_RemoveAndUpdate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("remove", func(t *testing.T) {
+		q := NewDelayQueue[delayElem](3)
+		h, err := q.EnqueueWithHandle(context.Background(), delayElem{val: 1, deadline: time.Now().Add(time.Millisecond * 10)})
+		require.NoError(t, err)
+		require.NoError(t, q.Enqueue(context.Background(), delayElem{val: 2, deadline: time.Now().Add(time.Millisecond * 20)}))
+		assert.True(t, q.Contains(h))
+		assert.True(t, q.Remove(h))
+		assert.False(t, q.Contains(h))
+		assert.False(t, q.Remove(h))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ele, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, ele.val)
+		// 已经出队的元素不能再修改
+		assert.False(t, q.Update(h, delayElem{val: 1}))
+	})
+
+	// 等待队首到期的时候队首被删除了，应该等待新的队首
+	t.Run("remove head while waiting", func(t *testing.T) {
+		q := NewDelayQueue[delayElem](3)
+		h, err := q.EnqueueWithHandle(context.Background(), delayElem{val: 1, deadline: time.Now().Add(time.Millisecond * 200)})
+		require.NoError(t, err)
+		require.NoError(t, q.Enqueue(context.Background(), delayElem{val: 2, deadline: time.Now().Add(time.Millisecond * 400)}))
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			assert.True(t, q.Remove(h))
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ele, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, ele.val)
+		assert.True(t, ele.deadline.Before(time.Now()))
+	})
+
+	// 等待期间把一个元素提前到期，应该立刻被唤醒
+	t.Run("update deadline while waiting", func(t *testing.T) {
+		q := NewDelayQueue[delayElem](3)
+		require.NoError(t, q.Enqueue(context.Background(), delayElem{val: 1, deadline: time.Now().Add(time.Second * 10)}))
+		h, err := q.EnqueueWithHandle(context.Background(), delayElem{val: 2, deadline: time.Now().Add(time.Second * 20)})
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			assert.True(t, q.Update(h, delayElem{val: 3, deadline: time.Now().Add(time.Millisecond * 50)}))
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ele, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, ele.val)
+		assert.Equal(t, ele, h.Value())
+	})
+
+	// 队列满了，删除元素之后等待入队的被唤醒
+	t.Run("remove while enqueue blocked", func(t *testing.T) {
+		q := NewDelayQueue[delayElem](1)
+		h, err := q.EnqueueWithHandle(context.Background(), delayElem{val: 1, deadline: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			assert.True(t, q.Remove(h))
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, q.Enqueue(ctx, delayElem{val: 2, deadline: time.Now()}))
+	})
+}
+
+// Handle.Value 和 Update 并发调用，需要配合 -race 运行
+func TestDelayQueue_HandleValueRace(t *testing.T) {
+	t.Parallel()
+	q := NewDelayQueue[delayElem](3)
+	h, err := q.EnqueueWithHandle(context.Background(), delayElem{val: 0, deadline: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 100; i++ {
+			q.Update(h, delayElem{val: i, deadline: time.Now().Add(time.Minute)})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = h.Value()
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, 100, h.Value().val)
+}
+
+func TestDelayQueue_TryDequeue(t *testing.T) {
+	t.Parallel()
+	q := NewDelayQueue[delayElem](3)
+	require.NoError(t, q.TryEnqueue(delayElem{val: 1, deadline: time.Now().Add(time.Millisecond * 50)}))
+	// 还没到期
+	_, err := q.TryDequeue()
+	assert.Equal(t, ErrEmptyQueue, err)
+	// Peek 不管有没有到期
+	ele, err := q.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ele.val)
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, 3, q.Cap())
+
+	time.Sleep(time.Millisecond * 60)
+	ele, err = q.TryDequeue()
+	require.NoError(t, err)
+	assert.Equal(t, 1, ele.val)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestDelayQueue_DequeueBatch(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	testCases := []struct {
+		name    string
+		eles    []delayElem
+		max     int
+		maxWait time.Duration
+		timeout time.Duration
+
+		wantErr  error
+		wantVals []int
+		// 剩下的元素
+		wantLeft int
+	}{
+		{
+			// 没有到期的元素不会被取出来
+			name: "only expired",
+			eles: []delayElem{
+				{val: 1, deadline: now.Add(-time.Second)},
+				{val: 2, deadline: now.Add(-time.Millisecond)},
+				{val: 3, deadline: now.Add(time.Minute)},
+			},
+			max:      3,
+			timeout:  time.Second,
+			wantVals: []int{1, 2},
+			wantLeft: 1,
+		},
+		{
+			// 等待第一个元素到期
+			name: "wait for first",
+			eles: []delayElem{
+				{val: 1, deadline: now.Add(time.Millisecond * 30)},
+				{val: 2, deadline: now.Add(time.Minute)},
+			},
+			max:      2,
+			timeout:  time.Second,
+			wantVals: []int{1},
+			wantLeft: 1,
+		},
+		{
+			// 凑批期间到期的元素也会被取出来
+			name: "expired while waiting",
+			eles: []delayElem{
+				{val: 1, deadline: now.Add(-time.Second)},
+				{val: 2, deadline: now.Add(time.Millisecond * 30)},
+				{val: 3, deadline: now.Add(time.Minute)},
+			},
+			max:      3,
+			maxWait:  time.Millisecond * 200,
+			timeout:  time.Second,
+			wantVals: []int{1, 2},
+			wantLeft: 1,
+		},
+		{
+			name: "nothing expired",
+			eles: []delayElem{
+				{val: 1, deadline: now.Add(time.Minute)},
+			},
+			max:      1,
+			maxWait:  time.Second,
+			timeout:  time.Millisecond * 30,
+			wantErr:  context.DeadlineExceeded,
+			wantLeft: 1,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			q := newDelayQueue(t, tc.eles...)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			start := time.Now()
+			eles, err := q.DequeueBatch(ctx, tc.max, tc.maxWait)
+			assert.Equal(t, tc.wantErr, err)
+			var vals []int
+			for _, ele := range eles {
+				vals = append(vals, ele.val)
+			}
+			assert.Equal(t, tc.wantVals, vals)
+			assert.Equal(t, tc.wantLeft, q.Len())
+			// 没有等到下一个元素到期
+			assert.Less(t, time.Since(start), time.Millisecond*500)
+			// 没有到期的元素 DrainTo 也不会取出来
+			assert.Empty(t, q.DrainTo(nil))
+		})
+	}
+}
+
 func newDelayQueue(t *testing.T, eles ...delayElem) *DelayQueue[delayElem] {
 	q := NewDelayQueue[delayElem](len(eles))
 	for _, ele := range eles {
@@ -0,0 +1,600 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errCorruptedRecord = errors.New("go_utils: 记录已经损坏")
+
+var _ Queue[any] = &DurableQueue[any]{}
+
+const (
+	// 记录的格式：[长度 4 字节][crc32 4 字节][数据]，crc32 同时覆盖长度和数据
+	recordHeaderSize = 8
+	// 超过这个长度的记录，读取之前先确认文件里面有这么多数据，避免长度损坏的时候分配过大的内存
+	largeRecordSize = 1 << 20
+	// checkpoint 文件里面有两个槽位，轮流写入，避免写到一半的时候宕机导致 checkpoint 丢失
+	// 每个槽位的格式：[序号 8 字节][段 8 字节][偏移量 8 字节][crc32 4 字节][填充 4 字节]
+	checkpointSlotSize = 32
+	checkpointFileName = "checkpoint"
+	segmentFileSuffix  = ".seg"
+
+	defaultSegmentSize = 64 << 20
+)
+
+// Codec 序列化和反序列化队列中的元素
+type Codec[T any] interface {
+	Encode(val T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec 使用 json 序列化
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(val T) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var t T
+	err := json.Unmarshal(data, &t)
+	return t, err
+}
+
+// SyncPolicy 刷盘策略
+type SyncPolicy int
+
+const (
+	// SyncNone 不主动刷盘，交给操作系统
+	// 进程崩溃不会丢数据，但是机器宕机可能会丢失最近写入的数据
+	SyncNone SyncPolicy = iota
+	// SyncAlways 每次写入数据和 checkpoint 之后都刷盘，最安全也最慢
+	SyncAlways
+	// SyncInterval 按照固定的间隔刷盘，机器宕机最多丢失一个间隔内的数据
+	SyncInterval
+)
+
+type durableQueueOptions struct {
+	segmentSize     int64
+	syncPolicy      SyncPolicy
+	syncInterval    time.Duration
+	checkpointEvery int
+}
+
+type DurableQueueOption func(o *durableQueueOptions)
+
+// WithSegmentSize 单个段文件的大小上限，写满之后滚动到新的段，默认 64MB
+// 单条记录超过上限的时候依旧会写入，独占一个段
+func WithSegmentSize(size int64) DurableQueueOption {
+	return func(o *durableQueueOptions) {
+		o.segmentSize = size
+	}
+}
+
+// WithSyncAlways 每次写入之后都刷盘
+func WithSyncAlways() DurableQueueOption {
+	return func(o *durableQueueOptions) {
+		o.syncPolicy = SyncAlways
+	}
+}
+
+// WithSyncInterval 按照 interval 定期刷盘
+func WithSyncInterval(interval time.Duration) DurableQueueOption {
+	return func(o *durableQueueOptions) {
+		o.syncPolicy = SyncInterval
+		o.syncInterval = interval
+	}
+}
+
+// WithCheckpointEvery 每出队 n 个元素保存一次消费进度，默认为 1
+// n 越大性能越好，但是重启之后重复消费的元素也越多
+func WithCheckpointEvery(n int) DurableQueueOption {
+	return func(o *durableQueueOptions) {
+		o.checkpointEvery = n
+	}
+}
+
+// DurableQueue 基于磁盘的持久化队列，重启之后可以从上一次的消费进度继续
+// 1. 元素通过 codec 序列化之后追加写入段文件，段文件写满之后滚动，消费完的段文件会被删除
+// 2. 消费进度保存在 checkpoint 文件里，重启之后从 checkpoint 开始消费
+// 3. 打开的时候会截断最后一个段末尾不完整的记录，例如写到一半的时候进程崩溃
+// 消费语义是至少一次：出队之后、保存 checkpoint 之前崩溃的话，重启之后这些元素会被再次消费
+// 同一个目录同时只能被一个 DurableQueue 使用
+type DurableQueue[T any] struct {
+	dir   string
+	codec Codec[T]
+	opts  durableQueueOptions
+
+	mu       *sync.Mutex
+	readCond *cond
+	closed   bool
+	// 还没有被消费的记录数
+	size int
+
+	writer      *os.File
+	writeSeg    uint64
+	writeOffset int64
+
+	reader     *os.File
+	readSeg    uint64
+	readOffset int64
+
+	checkpoint    *os.File
+	checkpointSeq uint64
+	// 上一次保存 checkpoint 之后出队的数量
+	uncheckpointed int
+
+	stopSync chan struct{}
+	syncDone chan struct{}
+}
+
+// NewDurableQueue 打开 dir 下的持久化队列，目录不存在的时候会创建
+func NewDurableQueue[T any](dir string, codec Codec[T], opts ...DurableQueueOption) (*DurableQueue[T], error) {
+	o := durableQueueOptions{
+		segmentSize:     defaultSegmentSize,
+		checkpointEvery: 1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.syncPolicy == SyncInterval && o.syncInterval <= 0 {
+		return nil, fmt.Errorf("go_utils: 非法的刷盘间隔 %s", o.syncInterval)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	mu := &sync.Mutex{}
+	q := &DurableQueue[T]{
+		dir:      dir,
+		codec:    codec,
+		opts:     o,
+		mu:       mu,
+		readCond: newCond(mu),
+	}
+	if err := q.recover(); err != nil {
+		_ = q.closeFiles()
+		return nil, err
+	}
+	if o.syncPolicy == SyncInterval {
+		q.stopSync = make(chan struct{})
+		q.syncDone = make(chan struct{})
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// recover 根据 checkpoint 和段文件恢复队列的状态
+func (q *DurableQueue[T]) recover() error {
+	var err error
+	q.checkpoint, err = os.OpenFile(filepath.Join(q.dir, checkpointFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	seq, cpSeg, cpOffset, err := readCheckpoint(q.checkpoint)
+	if err != nil {
+		return err
+	}
+	q.checkpointSeq = seq
+
+	segs, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+	// checkpoint 之前的段都已经消费完了，可能是删除之前崩溃了
+	live := segs[:0]
+	for _, seg := range segs {
+		if seg < cpSeg {
+			if err = os.Remove(q.segmentPath(seg)); err != nil {
+				return err
+			}
+			continue
+		}
+		live = append(live, seg)
+	}
+	if len(live) == 0 {
+		live = append(live, cpSeg)
+		if err = createFile(q.segmentPath(cpSeg)); err != nil {
+			return err
+		}
+	}
+	q.readSeg, q.readOffset = live[0], 0
+	if live[0] == cpSeg {
+		q.readOffset = cpOffset
+	}
+	q.writeSeg = live[len(live)-1]
+
+	// 只有最后一个段可能有写了一半的记录，截断到最后一条完整的记录
+	tail, err := os.OpenFile(q.segmentPath(q.writeSeg), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	cnt, end := countRecords(tail, 0)
+	if err = tail.Truncate(end); err != nil {
+		_ = tail.Close()
+		return err
+	}
+	if err = tail.Close(); err != nil {
+		return err
+	}
+	q.writeOffset = end
+	if q.readSeg == q.writeSeg && q.readOffset > end {
+		// 保存 checkpoint 的时候数据还没有落盘
+		q.readOffset = end
+	}
+
+	// 统计还没有消费的记录数
+	for _, seg := range live {
+		if seg == q.writeSeg && q.readSeg != q.writeSeg {
+			q.size += cnt
+			break
+		}
+		f, err := os.Open(q.segmentPath(seg))
+		if err != nil {
+			return err
+		}
+		offset := int64(0)
+		if seg == q.readSeg {
+			offset = q.readOffset
+		}
+		n, _ := countRecords(f, offset)
+		_ = f.Close()
+		q.size += n
+	}
+
+	if q.writer, err = os.OpenFile(q.segmentPath(q.writeSeg), os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return err
+	}
+	q.reader, err = os.Open(q.segmentPath(q.readSeg))
+	return err
+}
+
+func (q *DurableQueue[T]) Enqueue(ctx context.Context, val T) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	payload, err := q.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	if err = q.append(payload); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	q.size++
+	q.readCond.broadcast()
+	return nil
+}
+
+// Dequeue 出队，队列为空的时候阻塞
+// 反序列化失败的时候，这个元素依旧被认为已经消费了，避免一直卡在这个元素上
+func (q *DurableQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	var t T
+	if ctx.Err() != nil {
+		return t, ctx.Err()
+	}
+	q.mu.Lock()
+	for q.size == 0 && !q.closed {
+		ch := q.readCond.signalCh()
+		select {
+		case <-ctx.Done():
+			return t, ctx.Err()
+		case <-ch:
+			q.mu.Lock()
+		}
+	}
+	if q.closed {
+		q.mu.Unlock()
+		return t, ErrQueueClosed
+	}
+	payload, err := q.next()
+	q.mu.Unlock()
+	if err != nil {
+		return t, err
+	}
+	return q.codec.Decode(payload)
+}
+
+func (q *DurableQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close 保存消费进度并关闭文件，阻塞在 Dequeue 上的调用会返回 ErrQueueClosed
+func (q *DurableQueue[T]) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	err := q.saveCheckpoint()
+	if q.opts.syncPolicy != SyncNone {
+		err = errors.Join(err, q.writer.Sync(), q.checkpoint.Sync())
+	}
+	err = errors.Join(err, q.closeFiles())
+	// 唤醒所有阻塞的消费者
+	q.readCond.broadcast()
+	if q.stopSync != nil {
+		close(q.stopSync)
+		<-q.syncDone
+	}
+	return err
+}
+
+// append 追加一条记录，必须在锁范围内调用
+func (q *DurableQueue[T]) append(payload []byte) error {
+	size := int64(recordHeaderSize + len(payload))
+	if q.writeOffset > 0 && q.writeOffset+size > q.opts.segmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], recordChecksum(buf[0:4], payload))
+	copy(buf[recordHeaderSize:], payload)
+	if _, err := q.writer.Write(buf); err != nil {
+		// 去掉写了一半的记录，否则后面的记录都读不出来
+		return errors.Join(err, q.writer.Truncate(q.writeOffset))
+	}
+	q.writeOffset += size
+	if q.opts.syncPolicy == SyncAlways {
+		return q.writer.Sync()
+	}
+	return nil
+}
+
+// rotate 滚动到新的段，必须在锁范围内调用
+func (q *DurableQueue[T]) rotate() error {
+	if q.opts.syncPolicy != SyncNone {
+		if err := q.writer.Sync(); err != nil {
+			return err
+		}
+	}
+	path := q.segmentPath(q.writeSeg + 1)
+	if err := createFile(path); err != nil {
+		return err
+	}
+	if q.opts.syncPolicy == SyncAlways {
+		if err := syncDir(q.dir); err != nil {
+			return err
+		}
+	}
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_ = q.writer.Close()
+	q.writer = writer
+	q.writeSeg++
+	q.writeOffset = 0
+	return nil
+}
+
+// next 读取下一条记录，必须在锁范围内调用，调用方保证了 size > 0
+func (q *DurableQueue[T]) next() ([]byte, error) {
+	for {
+		payload, next, err := readRecord(q.reader, q.readOffset)
+		if err == nil {
+			q.readOffset = next
+			q.size--
+			q.uncheckpointed++
+			if q.uncheckpointed >= q.opts.checkpointEvery {
+				// 保存失败的话，下一次出队的时候会再次尝试
+				// 最坏的情况下重启之后会重复消费，这和至少一次的语义是一致的
+				_ = q.saveCheckpoint()
+			}
+			return payload, nil
+		}
+		if q.readSeg >= q.writeSeg {
+			return nil, err
+		}
+		// 当前的段已经读完了，或者剩下的部分已经损坏，切换到下一个段
+		if err = q.advance(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// advance 切换到下一个段并删除已经消费完的段，必须在锁范围内调用
+func (q *DurableQueue[T]) advance() error {
+	reader, err := os.Open(q.segmentPath(q.readSeg + 1))
+	if err != nil {
+		return err
+	}
+	_ = q.reader.Close()
+	old := q.readSeg
+	q.reader = reader
+	q.readSeg++
+	q.readOffset = 0
+	// 先保存 checkpoint 再删除，中间崩溃的话，重启的时候会删掉
+	if err = q.saveCheckpoint(); err != nil {
+		return err
+	}
+	return os.Remove(q.segmentPath(old))
+}
+
+// saveCheckpoint 保存消费进度，必须在锁范围内调用
+func (q *DurableQueue[T]) saveCheckpoint() error {
+	seq := q.checkpointSeq + 1
+	buf := make([]byte, checkpointSlotSize)
+	binary.BigEndian.PutUint64(buf[0:8], seq)
+	binary.BigEndian.PutUint64(buf[8:16], q.readSeg)
+	binary.BigEndian.PutUint64(buf[16:24], uint64(q.readOffset))
+	binary.BigEndian.PutUint32(buf[24:28], crc32.ChecksumIEEE(buf[:24]))
+	if _, err := q.checkpoint.WriteAt(buf, int64(seq%2)*checkpointSlotSize); err != nil {
+		return err
+	}
+	if q.opts.syncPolicy == SyncAlways {
+		if err := q.checkpoint.Sync(); err != nil {
+			return err
+		}
+	}
+	q.checkpointSeq = seq
+	q.uncheckpointed = 0
+	return nil
+}
+
+func (q *DurableQueue[T]) syncLoop() {
+	defer close(q.syncDone)
+	ticker := time.NewTicker(q.opts.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			if !q.closed {
+				_ = q.writer.Sync()
+				_ = q.checkpoint.Sync()
+			}
+			q.mu.Unlock()
+		case <-q.stopSync:
+			return
+		}
+	}
+}
+
+func (q *DurableQueue[T]) closeFiles() error {
+	var err error
+	for _, f := range []*os.File{q.writer, q.reader, q.checkpoint} {
+		if f != nil {
+			err = errors.Join(err, f.Close())
+		}
+	}
+	return err
+}
+
+func (q *DurableQueue[T]) segmentPath(seg uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seg, segmentFileSuffix))
+}
+
+// readRecord 读取 offset 处的记录，返回记录的数据和下一条记录的偏移量
+// 没有完整的记录的时候返回 io.EOF，校验失败的时候返回 errCorruptedRecord
+func readRecord(f *os.File, offset int64) ([]byte, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	if size > largeRecordSize {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		if offset+recordHeaderSize+size > info.Size() {
+			return nil, 0, io.EOF
+		}
+	}
+	payload := make([]byte, size)
+	if _, err := f.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, err
+	}
+	if recordChecksum(header[0:4], payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errCorruptedRecord
+	}
+	return payload, offset + recordHeaderSize + int64(len(payload)), nil
+}
+
+// recordChecksum 长度也要参与校验，否则全是 0 的数据会被当成合法的空记录
+func recordChecksum(length []byte, payload []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(length), crc32.IEEETable, payload)
+}
+
+// countRecords 统计从 offset 开始的完整记录数，同时返回最后一条完整记录的结束位置
+func countRecords(f *os.File, offset int64) (int, int64) {
+	cnt := 0
+	for {
+		_, next, err := readRecord(f, offset)
+		if err != nil {
+			return cnt, offset
+		}
+		cnt++
+		offset = next
+	}
+}
+
+// readCheckpoint 读取两个槽位中序号更大的有效 checkpoint，没有的时候返回 0
+func readCheckpoint(f *os.File) (seq uint64, seg uint64, offset int64, err error) {
+	buf := make([]byte, checkpointSlotSize*2)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, 0, 0, err
+	}
+	for i := 0; i+checkpointSlotSize <= n; i += checkpointSlotSize {
+		slot := buf[i : i+checkpointSlotSize]
+		if crc32.ChecksumIEEE(slot[:24]) != binary.BigEndian.Uint32(slot[24:28]) {
+			// 写到一半的槽位
+			continue
+		}
+		if s := binary.BigEndian.Uint64(slot[0:8]); s > seq {
+			seq = s
+			seg = binary.BigEndian.Uint64(slot[8:16])
+			offset = int64(binary.BigEndian.Uint64(slot[16:24]))
+		}
+	}
+	return seq, seg, offset, nil
+}
+
+// listSegments 返回 dir 下所有段的编号，从小到大排列
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentFileSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		seg, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, seg)
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+func createFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,322 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurableQueue_EnqueueDequeue(t *testing.T) {
+	type order struct {
+		Id   int
+		Name string
+	}
+	q, err := NewDurableQueue[order](t.TempDir(), JSONCodec[order]{})
+	require.NoError(t, err)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, q.Enqueue(ctx, order{Id: 1, Name: "a"}))
+	require.NoError(t, q.Enqueue(ctx, order{Id: 2, Name: "b"}))
+	assert.Equal(t, 2, q.Len())
+
+	val, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, order{Id: 1, Name: "a"}, val)
+	val, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, order{Id: 2, Name: "b"}, val)
+	assert.Equal(t, 0, q.Len())
+
+	// 队列为空的时候阻塞
+	tctx, tcancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer tcancel()
+	_, err = q.Dequeue(tctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// 阻塞期间有新元素进来
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		require.NoError(t, q.Enqueue(context.Background(), order{Id: 3}))
+	}()
+	val, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, order{Id: 3}, val)
+}
+
+func TestDurableQueue_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	q := newDurableQueue(t, dir)
+	enqueueInts(t, q, 1, 2, 3, 4, 5)
+	assert.Equal(t, []int{1, 2}, dequeueInts(t, q, 2))
+	require.NoError(t, q.Close())
+
+	q = newDurableQueue(t, dir)
+	defer q.Close()
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, []int{3, 4, 5}, dequeueInts(t, q, 3))
+}
+
+func TestDurableQueue_CrashRecovery(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 在崩溃之后修改最后一个段文件
+		corrupt func(t *testing.T, path string)
+
+		wantVals []int
+	}{
+		{
+			name:     "no corruption",
+			corrupt:  func(t *testing.T, path string) {},
+			wantVals: []int{1, 2, 3},
+		},
+		{
+			// 最后一条记录的头部只写了一半
+			name: "truncated mid header",
+			corrupt: func(t *testing.T, path string) {
+				// 去掉最后一条记录的数据和一半的头部
+				truncateTail(t, path, 1+recordHeaderSize/2)
+			},
+			wantVals: []int{1, 2},
+		},
+		{
+			// 最后一条记录的数据只写了一半，头部声明了 10 个字节，实际只有 2 个
+			name: "truncated mid payload",
+			corrupt: func(t *testing.T, path string) {
+				appendFile(t, path, []byte{0, 0, 0, 10, 1, 2, 3, 4, '1', '2'})
+			},
+			wantVals: []int{1, 2, 3},
+		},
+		{
+			// 预分配的空间没有写入数据，全是 0
+			name: "zero filled tail",
+			corrupt: func(t *testing.T, path string) {
+				appendFile(t, path, make([]byte, 64))
+			},
+			wantVals: []int{1, 2, 3},
+		},
+		{
+			name: "corrupted checksum",
+			corrupt: func(t *testing.T, path string) {
+				data := mustReadFile(t, path)
+				data[len(data)-1] ^= 0xff
+				require.NoError(t, os.WriteFile(path, data, 0o644))
+			},
+			wantVals: []int{1, 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q := newDurableQueue(t, dir)
+			enqueueInts(t, q, 1, 2, 3)
+			crash(t, q)
+			segs, err := listSegments(dir)
+			require.NoError(t, err)
+			tc.corrupt(t, q.segmentPath(segs[len(segs)-1]))
+
+			q = newDurableQueue(t, dir)
+			defer q.Close()
+			assert.Equal(t, len(tc.wantVals), q.Len())
+			// 恢复之后写入的数据也能正常读出来
+			enqueueInts(t, q, 100)
+			assert.Equal(t, append(tc.wantVals, 100), dequeueInts(t, q, len(tc.wantVals)+1))
+		})
+	}
+}
+
+func TestDurableQueue_Checkpoint(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []DurableQueueOption
+		// 崩溃之后修改 checkpoint 文件
+		corrupt func(t *testing.T, path string)
+
+		wantVals []int
+	}{
+		{
+			name:     "checkpoint every dequeue",
+			corrupt:  func(t *testing.T, path string) {},
+			wantVals: []int{3, 4, 5},
+		},
+		{
+			// 消费进度没有保存，重启之后重复消费
+			name:     "checkpoint every 10 dequeues",
+			opts:     []DurableQueueOption{WithCheckpointEvery(10)},
+			corrupt:  func(t *testing.T, path string) {},
+			wantVals: []int{1, 2, 3, 4, 5},
+		},
+		{
+			// 最后一次写 checkpoint 写到一半，退回到上一次的 checkpoint
+			name: "torn checkpoint",
+			corrupt: func(t *testing.T, path string) {
+				data := mustReadFile(t, path)
+				// 出队两次，第二次写在第 0 个槽位
+				data[10] ^= 0xff
+				require.NoError(t, os.WriteFile(path, data, 0o644))
+			},
+			wantVals: []int{2, 3, 4, 5},
+		},
+		{
+			name: "lost checkpoint",
+			corrupt: func(t *testing.T, path string) {
+				require.NoError(t, os.Remove(path))
+			},
+			wantVals: []int{1, 2, 3, 4, 5},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q := newDurableQueue(t, dir, tc.opts...)
+			enqueueInts(t, q, 1, 2, 3, 4, 5)
+			assert.Equal(t, []int{1, 2}, dequeueInts(t, q, 2))
+			crash(t, q)
+			tc.corrupt(t, filepath.Join(dir, checkpointFileName))
+
+			q = newDurableQueue(t, dir, tc.opts...)
+			defer q.Close()
+			assert.Equal(t, len(tc.wantVals), q.Len())
+			assert.Equal(t, tc.wantVals, dequeueInts(t, q, len(tc.wantVals)))
+		})
+	}
+}
+
+func TestDurableQueue_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	// 每条记录 9 个字节，每个段最多放 3 条
+	q := newDurableQueue(t, dir, WithSegmentSize(30))
+	vals := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	enqueueInts(t, q, vals...)
+	segs, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2}, segs)
+
+	// 消费完的段会被删除
+	assert.Equal(t, []int{1, 2, 3, 4}, dequeueInts(t, q, 4))
+	segs, err = listSegments(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2}, segs)
+
+	// 跨段恢复
+	crash(t, q)
+	q = newDurableQueue(t, dir, WithSegmentSize(30))
+	assert.Equal(t, 5, q.Len())
+	enqueueInts(t, q, 10)
+	assert.Equal(t, []int{5, 6, 7, 8, 9, 10}, dequeueInts(t, q, 6))
+	segs, err = listSegments(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3}, segs)
+	require.NoError(t, q.Close())
+
+	// 删除段之前崩溃，残留的段在打开的时候被清理
+	require.NoError(t, createFile(filepath.Join(dir, "00000000000000000001.seg")))
+	q = newDurableQueue(t, dir, WithSegmentSize(30))
+	defer q.Close()
+	segs, err = listSegments(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3}, segs)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestDurableQueue_SyncPolicy(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []DurableQueueOption
+
+		wantErr bool
+	}{
+		{name: "sync always", opts: []DurableQueueOption{WithSyncAlways()}},
+		{name: "sync interval", opts: []DurableQueueOption{WithSyncInterval(time.Millisecond)}},
+		{name: "invalid interval", opts: []DurableQueueOption{WithSyncInterval(0)}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			q, err := NewDurableQueue[int](dir, JSONCodec[int]{}, append(tc.opts, WithSegmentSize(30))...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			enqueueInts(t, q, 1, 2, 3, 4, 5)
+			time.Sleep(time.Millisecond * 5)
+			assert.Equal(t, []int{1, 2}, dequeueInts(t, q, 2))
+			require.NoError(t, q.Close())
+
+			q = newDurableQueue(t, dir, tc.opts...)
+			defer q.Close()
+			assert.Equal(t, []int{3, 4, 5}, dequeueInts(t, q, 3))
+		})
+	}
+}
+
+func TestDurableQueue_Close(t *testing.T) {
+	q := newDurableQueue(t, t.TempDir())
+	done := make(chan error)
+	go func() {
+		_, err := q.Dequeue(context.Background())
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	require.NoError(t, q.Close())
+	assert.Equal(t, ErrQueueClosed, <-done)
+	assert.Equal(t, ErrQueueClosed, q.Enqueue(context.Background(), 1))
+	// 重复关闭
+	assert.NoError(t, q.Close())
+}
+
+func newDurableQueue(t *testing.T, dir string, opts ...DurableQueueOption) *DurableQueue[int] {
+	q, err := NewDurableQueue[int](dir, JSONCodec[int]{}, opts...)
+	require.NoError(t, err)
+	return q
+}
+
+// crash 模拟进程崩溃：直接关闭文件，不保存消费进度
+func crash(t *testing.T, q *DurableQueue[int]) {
+	require.NoError(t, q.closeFiles())
+}
+
+func enqueueInts(t *testing.T, q *DurableQueue[int], vals ...int) {
+	for _, val := range vals {
+		require.NoError(t, q.Enqueue(context.Background(), val))
+	}
+}
+
+func dequeueInts(t *testing.T, q *DurableQueue[int], n int) []int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		val, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		res = append(res, val)
+	}
+	return res
+}
+
+func truncateTail(t *testing.T, path string, n int) {
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-int64(n)))
+}
+
+func appendFile(t *testing.T, path string, data []byte) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,250 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Queue[any] = &FairQueue[any]{}
+
+type fairQueueOptions struct {
+	capacity       int
+	tenantCapacity int
+	weights        map[string]int
+}
+
+type FairQueueOption func(o *fairQueueOptions)
+
+// WithFairQueueCapacity 所有租户加起来最多有多少个元素，默认不限制
+func WithFairQueueCapacity(capacity int) FairQueueOption {
+	return func(o *fairQueueOptions) {
+		o.capacity = capacity
+	}
+}
+
+// WithTenantCapacity 单个租户最多有多少个元素，默认不限制
+// 某个租户满了只会阻塞这个租户的入队，不影响其它租户
+func WithTenantCapacity(capacity int) FairQueueOption {
+	return func(o *fairQueueOptions) {
+		o.tenantCapacity = capacity
+	}
+}
+
+// WithTenantWeight 设置租户的权重，默认为 1
+// 每一轮里面，权重为 n 的租户最多可以连续出队 n 个元素
+func WithTenantWeight(tenant string, weight int) FairQueueOption {
+	return func(o *fairQueueOptions) {
+		o.weights[tenant] = weight
+	}
+}
+
+// FairQueue 多租户的公平队列，避免某个租户塞满队列之后其它租户饿死
+// 1. 每个租户有自己的先进先出子队列，租户由 tenant 从元素中提取
+// 2. 出队的时候按照差额轮询（Deficit Round Robin）在有元素的租户之间轮流，
+// 每一轮每个租户最多出队和自己权重一样多的元素
+// 3. 入队的时候，总数或者租户自己的元素数量达到上限都会阻塞
+// 4. 关闭之后入队返回 ErrQueueClosed，出队取完剩下的元素之后返回 ErrQueueClosed
+type FairQueue[T any] struct {
+	tenant         func(val T) string
+	maxSize        int
+	tenantCapacity int
+	weights        map[string]int
+
+	mu        *sync.Mutex
+	readCond  *cond
+	writeCond *cond
+	// 有元素的租户，子队列为空之后就会被删除
+	tenants map[string]*fairTenant[T]
+	// 轮询的顺序，队首是当前正在出队的租户
+	active *arrayDeque[*fairTenant[T]]
+	size   int
+}
+
+type fairTenant[T any] struct {
+	key   string
+	items *arrayDeque[T]
+	// 这一轮还可以出队多少个元素
+	deficit int
+}
+
+// NewFairQueue 创建公平队列，tenant 用于获取元素所属的租户
+func NewFairQueue[T any](tenant func(val T) string, opts ...FairQueueOption) *FairQueue[T] {
+	o := &fairQueueOptions{
+		weights: map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	mu := &sync.Mutex{}
+	return &FairQueue[T]{
+		tenant:         tenant,
+		maxSize:        o.capacity,
+		tenantCapacity: o.tenantCapacity,
+		weights:        o.weights,
+		mu:             mu,
+		readCond:       newCond(mu),
+		writeCond:      newCond(mu),
+		tenants:        map[string]*fairTenant[T]{},
+		active:         newArrayDeque[*fairTenant[T]](0),
+	}
+}
+
+// Enqueue 入队，总数或者租户的元素数量达到上限的时候阻塞
+func (f *FairQueue[T]) Enqueue(ctx context.Context, val T) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	key := f.tenant(val)
+	f.mu.Lock()
+	for f.isFull(key) && !f.writeCond.closed {
+		// 注意：这里接下来要进行睡眠，因此里面会把锁释放
+		ch := f.writeCond.signalCh()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+			f.mu.Lock()
+		}
+	}
+	if f.writeCond.closed {
+		f.mu.Unlock()
+		return ErrQueueClosed
+	}
+	f.pushTo(key, val)
+	f.readCond.broadcast()
+	return nil
+}
+
+// Dequeue 按照权重轮流从各个租户出队，队列为空的时候阻塞
+func (f *FairQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	if ctx.Err() != nil {
+		var t T
+		return t, ctx.Err()
+	}
+	f.mu.Lock()
+	for f.size == 0 && !f.readCond.closed {
+		ch := f.readCond.signalCh()
+		select {
+		case <-ctx.Done():
+			var t T
+			return t, ctx.Err()
+		case <-ch:
+			f.mu.Lock()
+		}
+	}
+	if f.size == 0 {
+		// 已经关闭并且取完了
+		f.mu.Unlock()
+		var t T
+		return t, ErrQueueClosed
+	}
+	val := f.pop()
+	f.writeCond.broadcast()
+	return val, nil
+}
+
+// Close 关闭队列，之后入队返回 ErrQueueClosed，阻塞的入队也会被唤醒并返回 ErrQueueClosed
+// 出队可以继续按照权重取走剩下的元素，取完之后返回 ErrQueueClosed
+// 重复关闭不会有任何效果
+func (f *FairQueue[T]) Close() {
+	closeQueue(f.mu, f.readCond, f.writeCond)
+}
+
+// CloseAndDrain 关闭队列，然后等待消费者取完剩下的元素
+// ctx 过期的时候还没有被取走的元素会按照出队的顺序全部取出来返回
+func (f *FairQueue[T]) CloseAndDrain(ctx context.Context) []T {
+	return closeAndDrain[T](ctx, f.mu, f.readCond, f.writeCond, f)
+}
+
+func (f *FairQueue[T]) length() int {
+	return f.size
+}
+
+func (f *FairQueue[T]) bounded() bool {
+	return f.maxSize > 0
+}
+
+func (f *FairQueue[T]) capacity() int {
+	return f.maxSize
+}
+
+// push 调用方保证队列没满，必须持有锁
+func (f *FairQueue[T]) push(val T) {
+	f.pushTo(f.tenant(val), val)
+}
+
+func (f *FairQueue[T]) pushTo(key string, val T) {
+	t, ok := f.tenants[key]
+	if !ok {
+		t = &fairTenant[T]{key: key, items: newArrayDeque[T](f.tenantCapacity)}
+		f.tenants[key] = t
+		f.active.pushBack(t)
+	}
+	t.items.pushBack(val)
+	f.size++
+}
+
+// pop 调用方保证队列不为空，必须持有锁
+func (f *FairQueue[T]) pop() T {
+	t := f.active.popFront()
+	if t.deficit <= 0 {
+		// 新的一轮
+		t.deficit = f.weight(t.key)
+	}
+	val := t.items.popFront()
+	t.deficit--
+	f.size--
+	switch {
+	case t.items.length() == 0:
+		// 没有元素了，下次入队的时候重新加入轮询，积攒的额度作废
+		delete(f.tenants, t.key)
+	case t.deficit > 0:
+		// 这一轮的额度还没用完，继续留在队首
+		f.active.pushFront(t)
+	default:
+		f.active.pushBack(t)
+	}
+	return val
+}
+
+func (f *FairQueue[T]) isFull(key string) bool {
+	if f.maxSize > 0 && f.size >= f.maxSize {
+		return true
+	}
+	if f.tenantCapacity <= 0 {
+		return false
+	}
+	t, ok := f.tenants[key]
+	return ok && t.items.length() >= f.tenantCapacity
+}
+
+func (f *FairQueue[T]) weight(key string) int {
+	if w := f.weights[key]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Len 所有租户的元素总数
+func (f *FairQueue[T]) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
+
+// TenantLen 某个租户的元素数量
+func (f *FairQueue[T]) TenantLen(tenant string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t, ok := f.tenants[tenant]; ok {
+		return t.items.length()
+	}
+	return 0
+}
+
+// SetWeight 修改租户的权重，从租户的下一轮开始生效
+func (f *FairQueue[T]) SetWeight(tenant string, weight int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.weights[tenant] = weight
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFairQueue_Dequeue(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []FairQueueOption
+		// 按照顺序入队
+		vals []string
+
+		wantVals []string
+	}{
+		{
+			name:     "single tenant",
+			vals:     []string{"a1", "a2", "a3"},
+			wantVals: []string{"a1", "a2", "a3"},
+		},
+		{
+			// 先入队的租户元素再多，也要和其它租户轮流出队
+			name:     "round robin",
+			vals:     []string{"a1", "a2", "a3", "a4", "b1", "b2", "c1"},
+			wantVals: []string{"a1", "b1", "c1", "a2", "b2", "a3", "a4"},
+		},
+		{
+			name:     "weighted",
+			opts:     []FairQueueOption{WithTenantWeight("a", 2), WithTenantWeight("b", 0)},
+			vals:     []string{"a1", "a2", "a3", "a4", "a5", "b1", "b2"},
+			wantVals: []string{"a1", "a2", "b1", "a3", "a4", "b2", "a5"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewFairQueue[string](tenantOf, tc.opts...)
+			for _, val := range tc.vals {
+				require.NoError(t, q.Enqueue(context.Background(), val))
+			}
+			assert.Equal(t, len(tc.vals), q.Len())
+			assert.Equal(t, tc.wantVals, dequeueStrings(t, q, len(tc.vals)))
+			assert.Equal(t, 0, q.Len())
+		})
+	}
+}
+
+func TestFairQueue_Interleaved(t *testing.T) {
+	q := NewFairQueue[string](tenantOf, WithTenantWeight("a", 2))
+	for _, val := range []string{"a1", "a2", "a3", "b1"} {
+		require.NoError(t, q.Enqueue(context.Background(), val))
+	}
+	// a 这一轮的额度还没有用完
+	assert.Equal(t, []string{"a1"}, dequeueStrings(t, q, 1))
+	// 新的租户排在最后面
+	require.NoError(t, q.Enqueue(context.Background(), "c1"))
+	assert.Equal(t, []string{"a2", "b1", "c1"}, dequeueStrings(t, q, 3))
+
+	// 租户的元素取完之后，额度作废，重新排队
+	require.NoError(t, q.Enqueue(context.Background(), "b2"))
+	q.SetWeight("a", 1)
+	require.NoError(t, q.Enqueue(context.Background(), "a4"))
+	assert.Equal(t, []string{"a3", "b2", "a4"}, dequeueStrings(t, q, 3))
+}
+
+func TestFairQueue_Capacity(t *testing.T) {
+	t.Run("tenant capacity", func(t *testing.T) {
+		q := NewFairQueue[string](tenantOf, WithTenantCapacity(2))
+		require.NoError(t, q.Enqueue(context.Background(), "a1"))
+		require.NoError(t, q.Enqueue(context.Background(), "a2"))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, q.Enqueue(ctx, "a3"))
+		// 其它租户不受影响
+		require.NoError(t, q.Enqueue(context.Background(), "b1"))
+		assert.Equal(t, 2, q.TenantLen("a"))
+		assert.Equal(t, 1, q.TenantLen("b"))
+		assert.Equal(t, 0, q.TenantLen("c"))
+
+		// 出队之后唤醒
+		go func() {
+			time.Sleep(time.Millisecond * 10)
+			_, err := q.Dequeue(context.Background())
+			assert.NoError(t, err)
+		}()
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, q.Enqueue(ctx, "a3"))
+		assert.Equal(t, []string{"b1", "a2", "a3"}, dequeueStrings(t, q, 3))
+	})
+
+	t.Run("total capacity", func(t *testing.T) {
+		q := NewFairQueue[string](tenantOf, WithFairQueueCapacity(2))
+		require.NoError(t, q.Enqueue(context.Background(), "a1"))
+		require.NoError(t, q.Enqueue(context.Background(), "b1"))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, q.Enqueue(ctx, "c1"))
+	})
+}
+
+func TestFairQueue_Blocking(t *testing.T) {
+	q := NewFairQueue[string](tenantOf)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := q.Dequeue(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		assert.NoError(t, q.Enqueue(context.Background(), "a1"))
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	val, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a1", val)
+}
+
+func TestFairQueue_Close(t *testing.T) {
+	q := NewFairQueue[string](tenantOf, WithTenantCapacity(2))
+	for _, val := range []string{"a1", "a2", "b1"} {
+		require.NoError(t, q.Enqueue(context.Background(), val))
+	}
+	// 租户满了阻塞住的入队被唤醒
+	errCh := make(chan error)
+	go func() {
+		errCh <- q.Enqueue(context.Background(), "a3")
+	}()
+	time.Sleep(time.Millisecond * 10)
+	q.Close()
+	assert.Equal(t, ErrQueueClosed, <-errCh)
+	assert.Equal(t, ErrQueueClosed, q.Enqueue(context.Background(), "c1"))
+
+	// 关闭之后依旧按照轮询的顺序取完剩下的元素
+	assert.Equal(t, []string{"a1", "b1"}, dequeueStrings(t, q, 2))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Equal(t, []string{"a2"}, q.CloseAndDrain(ctx))
+	_, err := q.Dequeue(context.Background())
+	assert.Equal(t, ErrQueueClosed, err)
+}
+
+// tenantOf 元素的第一个字母就是租户
+func tenantOf(val string) string {
+	return val[:1]
+}
+
+func dequeueStrings(t *testing.T, q Queue[string], n int) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		val, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		res = append(res, val)
+	}
+	return res
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueAbility 队列支持的能力，通用的测试用例按照能力挑选队列
+type queueAbility int
+
+const (
+	// abilityBlocking 实现了 BlockingQueue
+	abilityBlocking queueAbility = 1 << iota
+	// abilityBatch 实现了 BatchQueue
+	abilityBatch
+	// abilityClose 实现了 closableQueue
+	abilityClose
+	// abilityDeque 实现了 Deque
+	abilityDeque
+)
+
+type closableQueue interface {
+	Queue[int]
+	Close()
+	CloseAndDrain(ctx context.Context) []int
+}
+
+type closableBlockingQueue interface {
+	BlockingQueue[int]
+	closableQueue
+}
+
+type closableBatchQueue interface {
+	BatchQueue[int]
+	closableQueue
+}
+
+// queueFixture 测试用到的队列，入队的元素都是递增的，所以出队的顺序都是一样的
+type queueFixture struct {
+	name      string
+	newQueue  func(capacity int) Queue[int]
+	abilities queueAbility
+	// 容量为 0 的时候是否无界，数组实现容量为 0 的时候永远也放不下
+	boundless bool
+}
+
+// queueFixtures 所有的阻塞队列，新增队列或者新增能力的时候都要在这里登记
+// TestQueueFixtures 会检查登记的能力和实现是否一致
+var queueFixtures = []queueFixture{
+	{
+		name: "array",
+		newQueue: func(capacity int) Queue[int] {
+			return NewConcurrentArrayBlockingQueue[int](capacity)
+		},
+		abilities: abilityBlocking | abilityBatch | abilityClose,
+	},
+	{
+		name: "linked",
+		newQueue: func(capacity int) Queue[int] {
+			return NewConcurrentLinkedBlockingQueue[int](capacity)
+		},
+		abilities: abilityBlocking | abilityBatch | abilityClose,
+		boundless: true,
+	},
+	{
+		name: "priority",
+		newQueue: func(capacity int) Queue[int] {
+			return NewConcurrentPriorityBlockingQueue[int](capacity, compare())
+		},
+		abilities: abilityBlocking | abilityBatch | abilityClose,
+		boundless: true,
+	},
+	{
+		name: "delay",
+		newQueue: func(capacity int) Queue[int] {
+			return &delayIntQueue{DelayQueue: NewDelayQueue[delayElem](capacity)}
+		},
+		abilities: abilityBlocking | abilityBatch | abilityClose,
+		boundless: true,
+	},
+	{
+		name: "fair",
+		newQueue: func(capacity int) Queue[int] {
+			// 只有一个租户，出队的顺序和入队一样
+			return NewFairQueue[int](func(val int) string {
+				return ""
+			}, WithFairQueueCapacity(capacity))
+		},
+		abilities: abilityClose,
+		boundless: true,
+	},
+	{
+		name: "array deque",
+		newQueue: func(capacity int) Queue[int] {
+			return NewConcurrentArrayBlockingDeque[int](capacity)
+		},
+		abilities: abilityDeque | abilityClose,
+		boundless: true,
+	},
+	{
+		name: "linked deque",
+		newQueue: func(capacity int) Queue[int] {
+			return NewConcurrentLinkedBlockingDeque[int](capacity)
+		},
+		abilities: abilityDeque | abilityClose,
+		boundless: true,
+	},
+}
+
+// queuesWith 挑选出支持 ability 的队列，并且转换成 Q
+func queuesWith[Q any](t *testing.T, capacity int, ability queueAbility) map[string]func() Q {
+	res := make(map[string]func() Q, len(queueFixtures))
+	for _, f := range queueFixtures {
+		if f.abilities&ability != ability {
+			continue
+		}
+		f := f
+		res[f.name] = func() Q {
+			q, ok := f.newQueue(capacity).(Q)
+			require.True(t, ok, "%s 没有实现登记的能力", f.name)
+			return q
+		}
+	}
+	require.NotEmpty(t, res)
+	return res
+}
+
+func TestQueueFixtures(t *testing.T) {
+	for _, f := range queueFixtures {
+		t.Run(f.name, func(t *testing.T) {
+			q := f.newQueue(1)
+			_, ok := q.(BlockingQueue[int])
+			assert.Equal(t, f.abilities&abilityBlocking != 0, ok)
+			_, ok = q.(BatchQueue[int])
+			assert.Equal(t, f.abilities&abilityBatch != 0, ok)
+			_, ok = q.(closableQueue)
+			assert.Equal(t, f.abilities&abilityClose != 0, ok)
+			_, ok = q.(Deque[int])
+			assert.Equal(t, f.abilities&abilityDeque != 0, ok)
+		})
+	}
+}
+
+// delayIntQueue 把 DelayQueue 包装成 int 的队列
+// 元素入队的时候就已经到期了，到期时间按照值递增，所以出队的顺序和其它队列一样
+type delayIntQueue struct {
+	*DelayQueue[delayElem]
+}
+
+func expiredElem(val int) delayElem {
+	return delayElem{val: val, deadline: time.UnixMilli(int64(val))}
+}
+
+func elemVals(eles []delayElem, dst []int) []int {
+	for _, ele := range eles {
+		dst = append(dst, ele.val)
+	}
+	return dst
+}
+
+func (d *delayIntQueue) Enqueue(ctx context.Context, val int) error {
+	return d.DelayQueue.Enqueue(ctx, expiredElem(val))
+}
+
+func (d *delayIntQueue) Dequeue(ctx context.Context) (int, error) {
+	ele, err := d.DelayQueue.Dequeue(ctx)
+	return ele.val, err
+}
+
+func (d *delayIntQueue) CloseAndDrain(ctx context.Context) []int {
+	return elemVals(d.DelayQueue.CloseAndDrain(ctx), nil)
+}
+
+func (d *delayIntQueue) TryEnqueue(val int) error {
+	return d.DelayQueue.TryEnqueue(expiredElem(val))
+}
+
+func (d *delayIntQueue) TryDequeue() (int, error) {
+	ele, err := d.DelayQueue.TryDequeue()
+	return ele.val, err
+}
+
+func (d *delayIntQueue) Peek() (int, error) {
+	ele, err := d.DelayQueue.Peek()
+	return ele.val, err
+}
+
+func (d *delayIntQueue) EnqueueBatch(ctx context.Context, vals []int) error {
+	eles := make([]delayElem, 0, len(vals))
+	for _, val := range vals {
+		eles = append(eles, expiredElem(val))
+	}
+	return d.DelayQueue.EnqueueBatch(ctx, eles)
+}
+
+func (d *delayIntQueue) DequeueBatch(ctx context.Context, max int, maxWait time.Duration) ([]int, error) {
+	eles, err := d.DelayQueue.DequeueBatch(ctx, max, maxWait)
+	if eles == nil {
+		return nil, err
+	}
+	return elemVals(eles, make([]int, 0, len(eles))), err
+}
+
+func (d *delayIntQueue) DrainTo(dst []int) []int {
+	return elemVals(d.DelayQueue.DrainTo(nil), dst)
+}
@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Queue[any] = &IndexedPriorityQueue[any]{}
+
+// Handle 元素在 IndexedPriorityQueue 中的句柄，用于删除和更新元素
+type Handle[T any] struct {
+	val T
+	// 在堆中的下标，0 表示已经不在队列里了
+	index int
+	q     *IndexedPriorityQueue[T]
+	// 保护 val 的锁，队列被包装成并发安全的队列的时候才不为 nil
+	mu sync.Locker
+}
+
+// Value 入队或者最后一次 Update 时候的值
+func (h *Handle[T]) Value() T {
+	if h.mu != nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+	}
+	return h.val
+}
+
+// IndexedPriorityQueue 是一个带索引的小顶堆，和 PriorityQueue 一样按照 compare 出队
+// 入队的时候返回句柄，可以通过句柄在 O(log n) 内删除元素或者修改元素的优先级
+// 不是并发安全的
+type IndexedPriorityQueue[T any] struct {
+	compare  Comparator[T]
+	capacity int
+	// 0 位置留空，根节点从 1 开始
+	data []*Handle[T]
+	// 外层并发安全的队列使用的锁，会传给句柄，保证 Handle.Value 和 Update 不会并发读写
+	mu sync.Locker
+}
+
+// NewIndexedPriorityQueue 创建带索引的优先队列 capacity <= 0 时，为无界队列，否则有有界队列
+func NewIndexedPriorityQueue[T any](capacity int, compare Comparator[T]) *IndexedPriorityQueue[T] {
+	sliceCap := capacity + 1
+	if capacity <= 0 {
+		capacity = 0
+		sliceCap = 64
+	}
+	return &IndexedPriorityQueue[T]{
+		capacity: capacity,
+		data:     make([]*Handle[T], 1, sliceCap),
+		compare:  compare,
+	}
+}
+
+func (p *IndexedPriorityQueue[T]) Len() int {
+	return len(p.data) - 1
+}
+
+// Cap 无界队列返回0，有界队列返回创建队列时设置的值
+func (p *IndexedPriorityQueue[T]) Cap() int {
+	return p.capacity
+}
+
+func (p *IndexedPriorityQueue[T]) isFull() bool {
+	return p.capacity > 0 && len(p.data)-1 == p.capacity
+}
+
+func (p *IndexedPriorityQueue[T]) isEmpty() bool {
+	return len(p.data) < 2
+}
+
+func (p *IndexedPriorityQueue[T]) Peek() (T, error) {
+	if p.isEmpty() {
+		var t T
+		return t, ErrEmptyQueue
+	}
+	return p.data[1].val, nil
+}
+
+func (p *IndexedPriorityQueue[T]) Enqueue(ctx context.Context, val T) error {
+	_, err := p.EnqueueWithHandle(ctx, val)
+	return err
+}
+
+// EnqueueWithHandle 入队并返回句柄
+func (p *IndexedPriorityQueue[T]) EnqueueWithHandle(ctx context.Context, val T) (*Handle[T], error) {
+	if p.isFull() {
+		return nil, ErrOutOfCapacity
+	}
+	h := &Handle[T]{val: val, index: len(p.data), q: p, mu: p.mu}
+	p.data = append(p.data, h)
+	p.up(h.index)
+	return h, nil
+}
+
+func (p *IndexedPriorityQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	if p.isEmpty() {
+		var t T
+		return t, ErrEmptyQueue
+	}
+	h := p.data[1]
+	p.removeAt(1)
+	return h.val, nil
+}
+
+// Contains 元素是否还在队列里，出队或者被删除之后返回 false
+func (p *IndexedPriorityQueue[T]) Contains(h *Handle[T]) bool {
+	return h != nil && h.q == p && h.index > 0
+}
+
+// Remove 删除元素，元素不在队列里的时候返回 false
+func (p *IndexedPriorityQueue[T]) Remove(h *Handle[T]) bool {
+	if !p.Contains(h) {
+		return false
+	}
+	p.removeAt(h.index)
+	return true
+}
+
+// Update 修改元素的值，并且根据新的值调整位置，元素不在队列里的时候返回 false
+func (p *IndexedPriorityQueue[T]) Update(h *Handle[T], val T) bool {
+	if !p.Contains(h) {
+		return false
+	}
+	h.val = val
+	p.fix(h.index)
+	return true
+}
+
+// removeAt 删除下标为 i 的元素，用最后一个元素填补空位
+func (p *IndexedPriorityQueue[T]) removeAt(i int) {
+	last := len(p.data) - 1
+	removed := p.data[i]
+	p.swap(i, last)
+	p.data[last] = nil
+	p.data = p.data[:last]
+	removed.index = 0
+	if i < last {
+		p.fix(i)
+	}
+}
+
+// fix 下标为 i 的元素的值变了，上浮或者下沉到合适的位置
+func (p *IndexedPriorityQueue[T]) fix(i int) {
+	if !p.up(i) {
+		p.down(i)
+	}
+}
+
+// up 上浮，位置发生了变化的时候返回 true
+func (p *IndexedPriorityQueue[T]) up(i int) bool {
+	start := i
+	for parent := i / 2; parent > 0 && p.compare(p.data[i].val, p.data[parent].val) < 0; parent = i / 2 {
+		p.swap(i, parent)
+		i = parent
+	}
+	return i != start
+}
+
+func (p *IndexedPriorityQueue[T]) down(i int) {
+	n := len(p.data) - 1
+	for {
+		minPos := i
+		if left := i * 2; left <= n && p.compare(p.data[left].val, p.data[minPos].val) < 0 {
+			minPos = left
+		}
+		if right := i*2 + 1; right <= n && p.compare(p.data[right].val, p.data[minPos].val) < 0 {
+			minPos = right
+		}
+		if minPos == i {
+			return
+		}
+		p.swap(i, minPos)
+		i = minPos
+	}
+}
+
+func (p *IndexedPriorityQueue[T]) swap(i, j int) {
+	p.data[i], p.data[j] = p.data[j], p.data[i]
+	p.data[i].index = i
+	p.data[j].index = j
+}
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexedPriorityQueue_EnqueueDequeue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capacity int
+		data     []int
+
+		wantErr  error
+		expected []int
+	}{
+		{
+			name:     "boundless",
+			data:     []int{6, 5, 4, 3, 2, 1},
+			expected: []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:     "bounded",
+			capacity: 6,
+			data:     []int{3, 1, 6, 2, 5, 4},
+			expected: []int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:     "out of capacity",
+			capacity: 2,
+			data:     []int{2, 1, 3},
+			wantErr:  ErrOutOfCapacity,
+			expected: []int{1, 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewIndexedPriorityQueue[int](tc.capacity, compare())
+			var err error
+			for _, d := range tc.data {
+				if err = q.Enqueue(context.Background(), d); err != nil {
+					break
+				}
+			}
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.expected, dequeueAllIndexed(t, q))
+			_, err = q.Dequeue(context.Background())
+			assert.Equal(t, ErrEmptyQueue, err)
+			_, err = q.Peek()
+			assert.Equal(t, ErrEmptyQueue, err)
+		})
+	}
+}
+
+func TestIndexedPriorityQueue_Remove(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 删除第几个入队的元素
+		removes []int
+
+		expected []int
+	}{
+		{name: "remove head", removes: []int{0}, expected: []int{2, 3, 4, 5, 6, 7}},
+		{name: "remove last", removes: []int{6}, expected: []int{1, 2, 3, 4, 5, 6}},
+		{name: "remove middle", removes: []int{3, 1}, expected: []int{1, 3, 5, 6, 7}},
+		{name: "remove all", removes: []int{6, 5, 4, 3, 2, 1, 0}, expected: []int{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewIndexedPriorityQueue[int](0, compare())
+			handles := enqueueIndexed(t, q, 1, 2, 3, 4, 5, 6, 7)
+			for _, i := range tc.removes {
+				assert.True(t, q.Remove(handles[i]))
+				assert.False(t, q.Contains(handles[i]))
+				// 重复删除
+				assert.False(t, q.Remove(handles[i]))
+			}
+			assert.Equal(t, len(tc.expected), q.Len())
+			assert.Equal(t, tc.expected, dequeueAllIndexed(t, q))
+		})
+	}
+}
+
+func TestIndexedPriorityQueue_Update(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 修改第几个入队的元素
+		index int
+		val   int
+
+		expected []int
+	}{
+		{name: "increase head", index: 0, val: 10, expected: []int{2, 3, 4, 5, 10}},
+		{name: "decrease last", index: 4, val: 0, expected: []int{0, 1, 2, 3, 4}},
+		{name: "unchanged", index: 2, val: 3, expected: []int{1, 2, 3, 4, 5}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewIndexedPriorityQueue[int](0, compare())
+			handles := enqueueIndexed(t, q, 1, 2, 3, 4, 5)
+			assert.True(t, q.Update(handles[tc.index], tc.val))
+			assert.Equal(t, tc.val, handles[tc.index].Value())
+			assert.Equal(t, tc.expected, dequeueAllIndexed(t, q))
+			// 出队之后不能再修改
+			assert.False(t, q.Update(handles[tc.index], tc.val))
+		})
+	}
+}
+
+func TestIndexedPriorityQueue_Contains(t *testing.T) {
+	q1 := NewIndexedPriorityQueue[int](0, compare())
+	q2 := NewIndexedPriorityQueue[int](0, compare())
+	h := enqueueIndexed(t, q1, 1)[0]
+	assert.True(t, q1.Contains(h))
+	// 其它队列的句柄
+	assert.False(t, q2.Contains(h))
+	assert.False(t, q2.Remove(h))
+	assert.False(t, q1.Contains(nil))
+	_, err := q1.Dequeue(context.Background())
+	require.NoError(t, err)
+	assert.False(t, q1.Contains(h))
+}
+
+func enqueueIndexed(t *testing.T, q *IndexedPriorityQueue[int], vals ...int) []*Handle[int] {
+	handles := make([]*Handle[int], 0, len(vals))
+	for _, val := range vals {
+		h, err := q.EnqueueWithHandle(context.Background(), val)
+		require.NoError(t, err)
+		handles = append(handles, h)
+	}
+	return handles
+}
+
+func dequeueAllIndexed(t *testing.T, q *IndexedPriorityQueue[int]) []int {
+	res := make([]int, 0, q.Len())
+	for q.Len() > 0 {
+		peek, err := q.Peek()
+		require.NoError(t, err)
+		val, err := q.Dequeue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, peek, val)
+		res = append(res, val)
+	}
+	return res
+}
@@ -0,0 +1,11 @@
+-- KEYS[1] 处理中集合 KEYS[2] 数据 KEYS[3] 投递次数 KEYS[4] 回执
+-- ARGV[1] id ARGV[2] 回执
+if redis.call('hget', KEYS[4], ARGV[1]) ~= ARGV[2] then
+    -- 可见性超时之后已经被重新投递了
+    return 0
+end
+redis.call('zrem', KEYS[1], ARGV[1])
+redis.call('hdel', KEYS[2], ARGV[1])
+redis.call('hdel', KEYS[3], ARGV[1])
+redis.call('hdel', KEYS[4], ARGV[1])
+return 1
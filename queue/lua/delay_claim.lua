@@ -0,0 +1,34 @@
+-- KEYS[1] 延迟集合 KEYS[2] 处理中集合 KEYS[3] 数据 KEYS[4] 投递次数 KEYS[5] 回执
+-- ARGV[1] 可见性超时（毫秒） ARGV[2] 回执 ARGV[3] 每次最多重新投递的数量
+-- 拿到元素返回 {1, id, 数据, 投递次数}
+-- 没有到期的元素返回 {0, 距离最近的元素到期还有多少毫秒}，队列为空的时候为 -1
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+-- 可见性超时的元素，说明消费者已经宕机，放回延迟集合重新投递
+local expired = redis.call('zrangebyscore', KEYS[2], '-inf', now, 'limit', 0, tonumber(ARGV[3]))
+for _, id in ipairs(expired) do
+    redis.call('zrem', KEYS[2], id)
+    redis.call('hdel', KEYS[5], id)
+    redis.call('zadd', KEYS[1], now, id)
+end
+
+local ids = redis.call('zrangebyscore', KEYS[1], '-inf', now, 'limit', 0, 1)
+if #ids == 0 then
+    local head = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+    if #head == 0 then
+        return {0, -1}
+    end
+    return {0, tonumber(head[2]) - now}
+end
+
+local id = ids[1]
+redis.call('zrem', KEYS[1], id)
+redis.call('zadd', KEYS[2], now + tonumber(ARGV[1]), id)
+redis.call('hset', KEYS[5], id, ARGV[2])
+local attempts = redis.call('hincrby', KEYS[4], id, 1)
+local payload = redis.call('hget', KEYS[3], id)
+if not payload then
+    payload = ''
+end
+return {1, id, payload, attempts}
@@ -0,0 +1,8 @@
+-- KEYS[1] 延迟集合 KEYS[2] 数据
+-- ARGV[1] id ARGV[2] 数据 ARGV[3] 延迟（毫秒）
+-- 到期时间以 redis 的时间为准，避免不同机器之间的时钟偏差
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('hset', KEYS[2], ARGV[1], ARGV[2])
+redis.call('zadd', KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+return 1
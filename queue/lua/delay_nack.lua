@@ -0,0 +1,11 @@
+-- KEYS[1] 延迟集合 KEYS[2] 处理中集合 KEYS[3] 回执
+-- ARGV[1] id ARGV[2] 回执 ARGV[3] 重新投递的延迟（毫秒）
+if redis.call('hget', KEYS[3], ARGV[1]) ~= ARGV[2] then
+    return 0
+end
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('zrem', KEYS[2], ARGV[1])
+redis.call('hdel', KEYS[3], ARGV[1])
+redis.call('zadd', KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+return 1
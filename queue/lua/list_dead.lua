@@ -0,0 +1,5 @@
+-- KEYS[1] 消费者集合
+-- 返回心跳已经过期的消费者
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+return redis.call('zrangebyscore', KEYS[1], '-inf', now)
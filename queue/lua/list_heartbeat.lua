@@ -0,0 +1,6 @@
+-- KEYS[1] 消费者集合
+-- ARGV[1] 消费者 ARGV[2] 心跳的有效期（毫秒）
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('zadd', KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+return 1
@@ -0,0 +1,8 @@
+-- KEYS[1] 待处理列表 KEYS[2] 处理中列表
+-- ARGV[1] 元素
+if redis.call('lrem', KEYS[2], 1, ARGV[1]) == 0 then
+    return 0
+end
+-- 放回队首，下一个被消费
+redis.call('rpush', KEYS[1], ARGV[1])
+return 1
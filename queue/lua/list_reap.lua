@@ -0,0 +1,19 @@
+-- KEYS[1] 待处理列表 KEYS[2] 消费者集合 KEYS[2 + i] 第 i 个消费者的处理中列表
+-- ARGV[i] 第 i 个消费者
+-- 把心跳过期的消费者正在处理的元素放回队首，返回放回去的数量
+local t = redis.call('time')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local cnt = 0
+for i, consumer in ipairs(ARGV) do
+    local expireAt = redis.call('zscore', KEYS[2], consumer)
+    -- 已经被别人回收了，或者查询之后又恢复了心跳
+    if expireAt ~= false and tonumber(expireAt) <= now then
+        local processing = KEYS[2 + i]
+        -- 从最新的开始挪，最早出队的元素最后放到队首，最先被重新消费
+        while redis.call('lmove', processing, KEYS[1], 'LEFT', 'RIGHT') do
+            cnt = cnt + 1
+        end
+        redis.call('zrem', KEYS[2], consumer)
+    end
+end
+return cnt
@@ -8,9 +8,13 @@ import (
 var (
 	ErrOutOfCapacity = errors.New("go_utils: 超出最大容量限制")
 	ErrEmptyQueue    = errors.New("go_utils: 队列为空")
+	ErrQueueClosed   = errors.New("go_utils: 队列已经关闭")
 )
 
-var _ Queue[any] = &PriorityQueue[any]{}
+var (
+	_ Queue[any]            = &PriorityQueue[any]{}
+	_ NonBlockingQueue[any] = &PriorityQueue[any]{}
+)
 
 // PriorityQueue 是一个基于小顶堆的优先队列
 type PriorityQueue[T any] struct {
@@ -78,6 +82,16 @@ func (p *PriorityQueue[T]) Dequeue(ctx context.Context) (T, error) {
 	return res, nil
 }
 
+// TryEnqueue 和 Enqueue 一样，PriorityQueue 本身就不会阻塞
+func (p *PriorityQueue[T]) TryEnqueue(val T) error {
+	return p.Enqueue(context.Background(), val)
+}
+
+// TryDequeue 和 Dequeue 一样，PriorityQueue 本身就不会阻塞
+func (p *PriorityQueue[T]) TryDequeue() (T, error) {
+	return p.Dequeue(context.Background())
+}
+
 func (p *PriorityQueue[T]) heapify(data []T, n, i int) {
 	minPos := i
 	for {
@@ -108,3 +108,15 @@ func TestPriorityQueue_Peek(t *testing.T) {
 		})
 	}
 }
+
+func TestPriorityQueue_TryEnqueueDequeue(t *testing.T) {
+	pq := NewPriorityQueue[int](2, compare())
+	_, err := pq.TryDequeue()
+	assert.Equal(t, ErrEmptyQueue, err)
+	assert.NoError(t, pq.TryEnqueue(2))
+	assert.NoError(t, pq.TryEnqueue(1))
+	assert.Equal(t, ErrOutOfCapacity, pq.TryEnqueue(3))
+	val, err := pq.TryDequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, val)
+}
@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	ErrDeliveryExpired   = errors.New("go_utils: 可见性超时已过，消息可能已经被重新投递")
+	ErrInvalidVisibility = errors.New("go_utils: 可见性超时不能小于 1 毫秒")
+
+	//go:embed lua/delay_enqueue.lua
+	delayEnqueueLua string
+	//go:embed lua/delay_claim.lua
+	delayClaimLua string
+	//go:embed lua/delay_ack.lua
+	delayAckLua string
+	//go:embed lua/delay_nack.lua
+	delayNackLua string
+)
+
+const (
+	// redisDelayQueuePollInterval 没有到期元素的时候，最多等待多久再去 redis 看一眼
+	// 等待期间可能有更早到期的元素入队，所以不能一直等到队首元素到期
+	redisDelayQueuePollInterval = time.Second
+	// redisDelayQueueRedeliverBatch 每次抢元素的时候，最多把多少个超时的元素放回去重新投递
+	redisDelayQueueRedeliverBatch = 100
+)
+
+// RedisDelayQueue 基于 redis 的分布式延时队列，和 DelayQueue 一样按照 Deadline 出队
+// 1. 元素保存在以到期时间为分数的有序集合里，到期之后才能被消费
+// 2. 出队的时候通过 lua 脚本原子地把元素从延迟集合挪到处理中集合，并设置可见性超时
+// 3. 消费者处理完之后调用 Ack 删除元素，或者调用 Nack 延迟之后重新投递
+// 4. 消费者宕机的话，可见性超时之后元素会被重新投递给其它消费者
+// 所有的 key 都带有相同的 hash tag，在 redis cluster 下落在同一个 slot
+// 消费语义是至少一次，Ack 之前可见性超时的话，同一个元素可能被多个消费者处理
+type RedisDelayQueue[T Delayable] struct {
+	client redis.Cmdable
+	codec  Codec[T]
+	// 可见性超时，消费者需要在这个时间内 Ack 或者 Nack
+	visibility time.Duration
+
+	delayedKey    string
+	processingKey string
+	payloadKey    string
+	attemptsKey   string
+	receiptsKey   string
+}
+
+// NewRedisDelayQueue 创建分布式延时队列，使用同一个 name 的队列共享数据
+// visibility 精确到毫秒，小于 1 毫秒的时候返回 ErrInvalidVisibility
+func NewRedisDelayQueue[T Delayable](client redis.Cmdable,
+	name string,
+	codec Codec[T],
+	visibility time.Duration) (*RedisDelayQueue[T], error) {
+	if visibility < time.Millisecond {
+		// 否则出队的元素马上就会被重新投递，消费者来不及 Ack
+		return nil, ErrInvalidVisibility
+	}
+	return &RedisDelayQueue[T]{
+		client:        client,
+		codec:         codec,
+		visibility:    visibility,
+		delayedKey:    fmt.Sprintf("{%s}:delayed", name),
+		processingKey: fmt.Sprintf("{%s}:processing", name),
+		payloadKey:    fmt.Sprintf("{%s}:payload", name),
+		attemptsKey:   fmt.Sprintf("{%s}:attempts", name),
+		receiptsKey:   fmt.Sprintf("{%s}:receipts", name),
+	}, nil
+}
+
+// Enqueue 入队，val.Deadline() 之后才能被消费
+// 到期时间会被换算成相对 redis 时间的延迟，避免机器之间的时钟偏差
+func (q *RedisDelayQueue[T]) Enqueue(ctx context.Context, val T) error {
+	payload, err := q.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	delay := time.Until(val.Deadline()).Milliseconds()
+	return q.client.Eval(ctx, delayEnqueueLua, []string{q.delayedKey, q.payloadKey},
+		uuid.New().String(), payload, delay).Err()
+}
+
+// Dequeue 出队，没有到期元素的时候阻塞，直到拿到元素或者 ctx 过期
+// 反序列化失败的元素会被直接删除，避免一直被重新投递
+func (q *RedisDelayQueue[T]) Dequeue(ctx context.Context) (*DelayDelivery[T], error) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		receipt := uuid.New().String()
+		res, err := q.client.Eval(ctx, delayClaimLua,
+			[]string{q.delayedKey, q.processingKey, q.payloadKey, q.attemptsKey, q.receiptsKey},
+			q.visibility.Milliseconds(), receipt, redisDelayQueueRedeliverBatch).Slice()
+		if err != nil {
+			return nil, err
+		}
+		if len(res) == 4 {
+			return q.newDelivery(ctx, res, receipt)
+		}
+		if len(res) != 2 {
+			return nil, fmt.Errorf("go_utils: 非法的返回值 %v", res)
+		}
+		interval := redisDelayQueuePollInterval
+		if wait, _ := res[1].(int64); wait >= 0 {
+			interval = min(time.Duration(wait)*time.Millisecond, interval)
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *RedisDelayQueue[T]) newDelivery(ctx context.Context, res []any, receipt string) (*DelayDelivery[T], error) {
+	id, _ := res[1].(string)
+	payload, _ := res[2].(string)
+	attempts, _ := res[3].(int64)
+	d := &DelayDelivery[T]{
+		ID:       id,
+		Attempts: int(attempts),
+		q:        q,
+		receipt:  receipt,
+	}
+	val, err := q.codec.Decode([]byte(payload))
+	if err != nil {
+		return nil, errors.Join(err, d.Ack(ctx))
+	}
+	d.Value = val
+	return d, nil
+}
+
+// DelayDelivery 一次投递，消费者处理完之后必须调用 Ack 或者 Nack
+type DelayDelivery[T Delayable] struct {
+	ID    string
+	Value T
+	// 第几次投递，从 1 开始
+	Attempts int
+
+	q       *RedisDelayQueue[T]
+	receipt string
+}
+
+// Ack 确认消费成功，删除元素
+// 可见性超时之后元素可能已经被重新投递了，这时候返回 ErrDeliveryExpired
+func (d *DelayDelivery[T]) Ack(ctx context.Context) error {
+	res, err := d.q.client.Eval(ctx, delayAckLua,
+		[]string{d.q.processingKey, d.q.payloadKey, d.q.attemptsKey, d.q.receiptsKey},
+		d.ID, d.receipt).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrDeliveryExpired
+	}
+	return nil
+}
+
+// Nack 消费失败，delay 之后重新投递
+func (d *DelayDelivery[T]) Nack(ctx context.Context, delay time.Duration) error {
+	res, err := d.q.client.Eval(ctx, delayNackLua,
+		[]string{d.q.delayedKey, d.q.processingKey, d.q.receiptsKey},
+		d.ID, d.receipt, delay.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrDeliveryExpired
+	}
+	return nil
+}
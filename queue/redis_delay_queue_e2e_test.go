@@ -0,0 +1,71 @@
+//go:build e2e
+
+package queue
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestRedisDelayQueue_e2e(t *testing.T) {
+	rdb := getRdb()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	q, err := NewRedisDelayQueue[redisDelayElem](rdb, "e2e_delay", JSONCodec[redisDelayElem]{}, time.Millisecond*200)
+	require.NoError(t, err)
+	defer rdb.Del(ctx, q.delayedKey, q.processingKey, q.payloadKey, q.attemptsKey, q.receiptsKey)
+
+	now := time.Now()
+	require.NoError(t, q.Enqueue(ctx, redisDelayElem{At: now.Add(time.Millisecond * 300), Val: 2}))
+	require.NoError(t, q.Enqueue(ctx, redisDelayElem{At: now.Add(time.Millisecond * 100), Val: 1}))
+
+	// 按照到期时间出队
+	d, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, d.Value.Val)
+	assert.True(t, time.Since(now) >= time.Millisecond*90)
+	require.NoError(t, d.Ack(ctx))
+
+	// Nack 之后重新投递
+	d, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.Value.Val)
+	assert.Equal(t, 1, d.Attempts)
+	require.NoError(t, d.Nack(ctx, time.Millisecond*50))
+	assert.Equal(t, ErrDeliveryExpired, d.Ack(ctx))
+
+	// 消费者没有 Ack，可见性超时之后重新投递
+	d, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.Attempts)
+	redelivered, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, redelivered.Value.Val)
+	assert.Equal(t, 3, redelivered.Attempts)
+	// 旧的回执已经失效
+	assert.Equal(t, ErrDeliveryExpired, d.Ack(ctx))
+	require.NoError(t, redelivered.Ack(ctx))
+
+	n, err := rdb.Exists(ctx, q.delayedKey, q.processingKey, q.payloadKey, q.attemptsKey, q.receiptsKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func getRdb() *redis.Client {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: "192.168.31.165:6379",
+	})
+	ping := rdb.Ping(context.Background())
+	res, err := ping.Result()
+	if err != nil {
+		log.Fatalln(err)
+		return nil
+	}
+	log.Println(res)
+	return rdb
+}
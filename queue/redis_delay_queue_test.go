@@ -0,0 +1,309 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+var delayQueueKeys = []string{"{order}:delayed", "{order}:processing", "{order}:payload",
+	"{order}:attempts", "{order}:receipts"}
+
+func TestNewRedisDelayQueue(t *testing.T) {
+	testCases := []struct {
+		name       string
+		visibility time.Duration
+
+		wantErr error
+	}{
+		{name: "valid", visibility: time.Millisecond},
+		{name: "zero", visibility: 0, wantErr: ErrInvalidVisibility},
+		{name: "negative", visibility: -time.Second, wantErr: ErrInvalidVisibility},
+		{name: "less than 1ms", visibility: time.Microsecond, wantErr: ErrInvalidVisibility},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisDelayQueue[redisDelayElem](mocks.NewMockCmdable(ctrl), "order",
+				JSONCodec[redisDelayElem]{}, tc.visibility)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.visibility, q.visibility)
+		})
+	}
+}
+
+func TestRedisDelayQueue_Enqueue(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "enqueued",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), delayEnqueueLua, []string{"{order}:delayed", "{order}:payload"},
+					gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+						var elem redisDelayElem
+						require.NoError(t, json.Unmarshal(args[1].([]byte), &elem))
+						assert.Equal(t, 123, elem.Val)
+						// 一分钟之后到期
+						delay := args[2].(int64)
+						assert.True(t, delay > 59000 && delay <= 60000)
+						return res
+					})
+				return cmd
+			},
+		},
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(gomock.Any(), delayEnqueueLua, []string{"{order}:delayed", "{order}:payload"},
+					gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(res)
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisDelayQueue[redisDelayElem](tc.mock(ctrl), "order", JSONCodec[redisDelayElem]{}, time.Minute)
+			require.NoError(t, err)
+			err = q.Enqueue(context.Background(), redisDelayElem{At: time.Now().Add(time.Minute), Val: 123})
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestRedisDelayQueue_Dequeue(t *testing.T) {
+	payload, err := json.Marshal(redisDelayElem{Val: 123})
+	require.NoError(t, err)
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		timeout time.Duration
+
+		wantErr      error
+		wantID       string
+		wantVal      int
+		wantAttempts int
+	}{
+		{
+			name: "claimed",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				expectClaim(cmd, []any{int64(1), "id1", string(payload), int64(2)}, nil)
+				return cmd
+			},
+			timeout:      time.Second,
+			wantID:       "id1",
+			wantVal:      123,
+			wantAttempts: 2,
+		},
+		{
+			// 队首的元素还没到期，等到期之后再抢
+			name: "wait for deadline",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					expectClaim(cmd, []any{int64(0), int64(10)}, nil),
+					expectClaim(cmd, []any{int64(1), "id1", string(payload), int64(1)}, nil),
+				)
+				return cmd
+			},
+			timeout:      time.Second,
+			wantID:       "id1",
+			wantVal:      123,
+			wantAttempts: 1,
+		},
+		{
+			name: "empty timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				expectClaim(cmd, []any{int64(0), int64(-1)}, nil)
+				return cmd
+			},
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				expectClaim(cmd, nil, context.DeadlineExceeded)
+				return cmd
+			},
+			timeout: time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisDelayQueue[redisDelayElem](tc.mock(ctrl), "order", JSONCodec[redisDelayElem]{}, time.Minute)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			d, err := q.Dequeue(ctx)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantID, d.ID)
+			assert.Equal(t, tc.wantVal, d.Value.Val)
+			assert.Equal(t, tc.wantAttempts, d.Attempts)
+		})
+	}
+
+	// 反序列化失败的元素直接删除
+	t.Run("invalid payload", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		cmd := mocks.NewMockCmdable(ctrl)
+		var receipt string
+		expectClaim(cmd, []any{int64(1), "id1", "invalid", int64(1)}, nil).
+			Do(func(ctx context.Context, script string, keys []string, args ...any) {
+				receipt = args[1].(string)
+			})
+		ackRes := redis.NewCmd(context.Background())
+		ackRes.SetVal(int64(1))
+		cmd.EXPECT().Eval(gomock.Any(), delayAckLua, delayQueueKeys[1:], "id1", gomock.Any()).
+			DoAndReturn(func(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+				assert.Equal(t, receipt, args[1])
+				return ackRes
+			})
+		q, err := NewRedisDelayQueue[redisDelayElem](cmd, "order", JSONCodec[redisDelayElem]{}, time.Minute)
+		require.NoError(t, err)
+		_, err = q.Dequeue(context.Background())
+		var syntaxErr *json.SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+	})
+}
+
+func TestDelayDelivery_AckAndNack(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+		// 调用 Ack 或者 Nack
+		fn func(d *DelayDelivery[redisDelayElem]) error
+
+		wantErr error
+	}{
+		{
+			name: "acked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), delayAckLua, delayQueueKeys[1:], "id1", "receipt1").
+					Return(res)
+				return cmd
+			},
+			fn: func(d *DelayDelivery[redisDelayElem]) error {
+				return d.Ack(context.Background())
+			},
+		},
+		{
+			// 可见性超时之后被重新投递，回执已经变了
+			name: "ack expired",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(gomock.Any(), delayAckLua, delayQueueKeys[1:], "id1", "receipt1").
+					Return(res)
+				return cmd
+			},
+			fn: func(d *DelayDelivery[redisDelayElem]) error {
+				return d.Ack(context.Background())
+			},
+			wantErr: ErrDeliveryExpired,
+		},
+		{
+			name: "nacked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), delayNackLua,
+					[]string{"{order}:delayed", "{order}:processing", "{order}:receipts"},
+					"id1", "receipt1", int64(5000)).
+					Return(res)
+				return cmd
+			},
+			fn: func(d *DelayDelivery[redisDelayElem]) error {
+				return d.Nack(context.Background(), time.Second*5)
+			},
+		},
+		{
+			name: "nack expired",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(gomock.Any(), delayNackLua,
+					[]string{"{order}:delayed", "{order}:processing", "{order}:receipts"},
+					"id1", "receipt1", int64(0)).
+					Return(res)
+				return cmd
+			},
+			fn: func(d *DelayDelivery[redisDelayElem]) error {
+				return d.Nack(context.Background(), 0)
+			},
+			wantErr: ErrDeliveryExpired,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisDelayQueue[redisDelayElem](tc.mock(ctrl), "order", JSONCodec[redisDelayElem]{}, time.Minute)
+			require.NoError(t, err)
+			d := &DelayDelivery[redisDelayElem]{ID: "id1", q: q, receipt: "receipt1"}
+			assert.Equal(t, tc.wantErr, tc.fn(d))
+		})
+	}
+}
+
+func expectClaim(cmd *mocks.MockCmdable, val []any, err error) *gomock.Call {
+	res := redis.NewCmd(context.Background())
+	if err != nil {
+		res.SetErr(err)
+	} else {
+		res.SetVal(val)
+	}
+	return cmd.EXPECT().Eval(gomock.Any(), delayClaimLua, delayQueueKeys,
+		int64(60000), gomock.Any(), redisDelayQueueRedeliverBatch).
+		Return(res)
+}
+
+type redisDelayElem struct {
+	At  time.Time
+	Val int
+}
+
+func (r redisDelayElem) Deadline() time.Time {
+	return r.At
+}
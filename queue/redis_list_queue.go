@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNotInProcessing = errors.New("go_utils: 元素不在处理中列表里，可能已经被回收")
+	ErrInvalidTTL      = errors.New("go_utils: 心跳的有效期不能小于 1 毫秒")
+
+	//go:embed lua/list_heartbeat.lua
+	listHeartbeatLua string
+	//go:embed lua/list_nack.lua
+	listNackLua string
+	//go:embed lua/list_dead.lua
+	listDeadLua string
+	//go:embed lua/list_reap.lua
+	listReapLua string
+)
+
+// redisListQueueBlockTimeout 单次 BLMOVE 阻塞的时间，到期之后检查一下 ctx 再继续等待
+const redisListQueueBlockTimeout = time.Second
+
+var _ Queue[any] = &RedisListQueue[any]{}
+
+// RedisListQueue 基于 redis 列表的分布式先进先出队列，消费语义是至少一次
+// 1. Dequeue 通过 BLMOVE 把元素原子地挪到当前消费者自己的处理中列表
+// 2. 消费者处理完之后调用 Ack 删除元素，或者调用 Nack 放回队首
+// 3. 每个消费者定期发送心跳，心跳过期的消费者被认为已经宕机，Reap 会把它正在处理的元素放回队首
+// Ack 和 Nack 通过重新序列化 val 在处理中列表里找到元素，
+// 所以 codec 必须保证同一个值每次序列化的结果都一样
+// 需要 redis 6.2 及以上的版本
+type RedisListQueue[T any] struct {
+	client   redis.Cmdable
+	codec    Codec[T]
+	consumer string
+	// 心跳的有效期，超过这个时间没有心跳的消费者会被回收
+	ttl time.Duration
+
+	pendingKey string
+	// 所有消费者的处理中列表的公共前缀，后面拼上 consumer
+	processingPrefix string
+	processingKey    string
+	consumersKey     string
+	// 上一次发送心跳的时间
+	lastHeartbeat atomic.Int64
+}
+
+// NewRedisListQueue 创建分布式队列，使用同一个 name 的队列共享数据
+// consumer 是当前消费者的唯一标识，不同的进程必须使用不同的 consumer
+// ttl 精确到毫秒，小于 1 毫秒的时候返回 ErrInvalidTTL
+func NewRedisListQueue[T any](client redis.Cmdable,
+	name string,
+	consumer string,
+	codec Codec[T],
+	ttl time.Duration) (*RedisListQueue[T], error) {
+	if ttl < time.Millisecond {
+		// 否则心跳一写入就过期了，处理中的元素会被马上回收
+		return nil, ErrInvalidTTL
+	}
+	processingPrefix := fmt.Sprintf("{%s}:processing:", name)
+	return &RedisListQueue[T]{
+		client:           client,
+		codec:            codec,
+		consumer:         consumer,
+		ttl:              ttl,
+		pendingKey:       fmt.Sprintf("{%s}:pending", name),
+		processingPrefix: processingPrefix,
+		processingKey:    processingPrefix + consumer,
+		consumersKey:     fmt.Sprintf("{%s}:consumers", name),
+	}, nil
+}
+
+func (q *RedisListQueue[T]) Enqueue(ctx context.Context, val T) error {
+	payload, err := q.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	return q.client.LPush(ctx, q.pendingKey, payload).Err()
+}
+
+// Dequeue 出队，队列为空的时候阻塞，直到拿到元素或者 ctx 过期
+// 拿到的元素在 Ack 之前会一直留在处理中列表里
+// 反序列化失败的元素会被直接删除，避免一直被重新投递
+func (q *RedisListQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	var t T
+	for {
+		if ctx.Err() != nil {
+			return t, ctx.Err()
+		}
+		// 必须先注册心跳，否则宕机之后处理中的元素没有人回收
+		if err := q.heartbeatIfNeeded(ctx); err != nil {
+			return t, err
+		}
+		payload, err := q.client.BLMove(ctx, q.pendingKey, q.processingKey,
+			"RIGHT", "LEFT", redisListQueueBlockTimeout).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return t, err
+		}
+		val, err := q.codec.Decode([]byte(payload))
+		if err != nil {
+			return t, errors.Join(err, q.client.LRem(ctx, q.processingKey, 1, payload).Err())
+		}
+		return val, nil
+	}
+}
+
+// Ack 确认消费成功，从处理中列表删除
+// 元素已经被回收的时候返回 ErrNotInProcessing，这时候它可能已经被别的消费者处理了
+func (q *RedisListQueue[T]) Ack(ctx context.Context, val T) error {
+	payload, err := q.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	res, err := q.client.LRem(ctx, q.processingKey, 1, payload).Result()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrNotInProcessing
+	}
+	return nil
+}
+
+// Nack 消费失败，放回队首，下一次 Dequeue 的时候被重新消费
+func (q *RedisListQueue[T]) Nack(ctx context.Context, val T) error {
+	payload, err := q.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	res, err := q.client.Eval(ctx, listNackLua, []string{q.pendingKey, q.processingKey}, payload).Int64()
+	if err != nil {
+		return err
+	}
+	if res == 0 {
+		return ErrNotInProcessing
+	}
+	return nil
+}
+
+// Heartbeat 发送心跳，处理单个元素的时间比较长的时候，需要在处理期间调用，或者使用 Run
+func (q *RedisListQueue[T]) Heartbeat(ctx context.Context) error {
+	err := q.client.Eval(ctx, listHeartbeatLua, []string{q.consumersKey},
+		q.consumer, q.ttl.Milliseconds()).Err()
+	if err != nil {
+		return err
+	}
+	q.lastHeartbeat.Store(time.Now().UnixNano())
+	return nil
+}
+
+// heartbeatIfNeeded 距离上一次心跳超过 ttl 的三分之一才发送心跳
+func (q *RedisListQueue[T]) heartbeatIfNeeded(ctx context.Context) error {
+	if time.Since(time.Unix(0, q.lastHeartbeat.Load())) < q.ttl/3 {
+		return nil
+	}
+	return q.Heartbeat(ctx)
+}
+
+// Reap 把心跳过期的消费者正在处理的元素放回队首，返回放回去的元素数量
+// 任何一个消费者都可以调用
+// 脚本只能访问声明过的 key，所以先查出过期的消费者，再把它们的处理中列表传给回收脚本
+// 回收脚本会再检查一次心跳，两次调用之间恢复了心跳的消费者不会被回收
+func (q *RedisListQueue[T]) Reap(ctx context.Context) (int64, error) {
+	dead, err := q.client.Eval(ctx, listDeadLua, []string{q.consumersKey}).StringSlice()
+	if err != nil || len(dead) == 0 {
+		return 0, err
+	}
+	keys := make([]string, 0, len(dead)+2)
+	keys = append(keys, q.pendingKey, q.consumersKey)
+	args := make([]any, 0, len(dead))
+	for _, consumer := range dead {
+		keys = append(keys, q.processingPrefix+consumer)
+		args = append(args, consumer)
+	}
+	return q.client.Eval(ctx, listReapLua, keys, args...).Int64()
+}
+
+// Run 每隔 interval 发送一次心跳并且回收宕机的消费者，阻塞直到 ctx 过期
+// interval 应该比 ttl 小很多，否则处理时间长的消费者会被误判为宕机
+// 使用 go q.Run(ctx, interval)
+func (q *RedisListQueue[T]) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 失败了就等下一次，偶尔失败不会导致心跳过期
+			_ = q.Heartbeat(ctx)
+			_, _ = q.Reap(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
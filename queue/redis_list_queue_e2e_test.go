@@ -0,0 +1,59 @@
+//go:build e2e
+
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisListQueue_e2e(t *testing.T) {
+	rdb := getRdb()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	q1, err := NewRedisListQueue[int](rdb, "e2e_list", "c1", JSONCodec[int]{}, time.Millisecond*300)
+	require.NoError(t, err)
+	q2, err := NewRedisListQueue[int](rdb, "e2e_list", "c2", JSONCodec[int]{}, time.Millisecond*300)
+	require.NoError(t, err)
+	defer rdb.Del(ctx, q1.pendingKey, q1.processingKey, q2.processingKey, q1.consumersKey)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, q1.Enqueue(ctx, i))
+	}
+
+	// 先进先出
+	val, err := q1.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, val)
+	require.NoError(t, q1.Ack(ctx, val))
+	assert.Equal(t, ErrNotInProcessing, q1.Ack(ctx, val))
+
+	// Nack 之后放回队首
+	val, err = q1.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, val)
+	require.NoError(t, q1.Nack(ctx, val))
+	val, err = q2.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, val)
+
+	// c2 没有 Ack 也没有心跳，过期之后被 c1 回收
+	time.Sleep(time.Millisecond * 400)
+	require.NoError(t, q1.Heartbeat(ctx))
+	n, err := q1.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, ErrNotInProcessing, q2.Ack(ctx, 2))
+
+	assert.Equal(t, []int{2, 3}, []int{mustDequeue(t, q1), mustDequeue(t, q1)})
+}
+
+func mustDequeue(t *testing.T, q *RedisListQueue[int]) int {
+	val, err := q.Dequeue(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, q.Ack(context.Background(), val))
+	return val
+}
@@ -0,0 +1,385 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go_utils/cache/mocks"
+	"testing"
+	"time"
+)
+
+func TestRedisListQueue_Enqueue(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+	}{
+		{
+			name: "enqueued",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewIntCmd(context.Background())
+				res.SetVal(1)
+				cmd.EXPECT().LPush(gomock.Any(), "{order}:pending", []byte("123")).Return(res)
+				return cmd
+			},
+		},
+		{
+			name: "lpush error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewIntCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().LPush(gomock.Any(), "{order}:pending", []byte("123")).Return(res)
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisListQueue[int](tc.mock(ctrl), "order", "c1", JSONCodec[int]{}, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantErr, q.Enqueue(context.Background(), 123))
+		})
+	}
+}
+
+func TestRedisListQueue_Dequeue(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) redis.Cmdable
+		timeout time.Duration
+
+		wantErr error
+		wantVal int
+	}{
+		{
+			name: "dequeued",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					expectListHeartbeat(cmd, nil),
+					expectBLMove(cmd, "123", nil),
+				)
+				return cmd
+			},
+			timeout: time.Second,
+			wantVal: 123,
+		},
+		{
+			// BLMOVE 超时之后继续等待
+			name: "retry after block timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				gomock.InOrder(
+					expectListHeartbeat(cmd, nil),
+					expectBLMove(cmd, "", redis.Nil),
+					expectBLMove(cmd, "123", nil),
+				)
+				return cmd
+			},
+			timeout: time.Second,
+			wantVal: 123,
+		},
+		{
+			name: "empty timeout",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				expectListHeartbeat(cmd, nil)
+				expectBLMove(cmd, "", redis.Nil).
+					Do(func(ctx context.Context, source, destination, srcpos, destpos string, timeout time.Duration) {
+						<-ctx.Done()
+					})
+				return cmd
+			},
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "heartbeat error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				expectListHeartbeat(cmd, context.DeadlineExceeded)
+				return cmd
+			},
+			timeout: time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "blmove error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				expectListHeartbeat(cmd, nil)
+				expectBLMove(cmd, "", context.DeadlineExceeded)
+				return cmd
+			},
+			timeout: time.Second,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisListQueue[int](tc.mock(ctrl), "order", "c1", JSONCodec[int]{}, time.Minute)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			val, err := q.Dequeue(ctx)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+
+	// 反序列化失败的元素直接删除
+	t.Run("invalid payload", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		cmd := mocks.NewMockCmdable(ctrl)
+		expectListHeartbeat(cmd, nil)
+		expectBLMove(cmd, "invalid", nil)
+		res := redis.NewIntCmd(context.Background())
+		res.SetVal(1)
+		cmd.EXPECT().LRem(gomock.Any(), "{order}:processing:c1", int64(1), "invalid").Return(res)
+		q, err := NewRedisListQueue[int](cmd, "order", "c1", JSONCodec[int]{}, time.Minute)
+		require.NoError(t, err)
+		_, err = q.Dequeue(context.Background())
+		var syntaxErr *json.SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr))
+	})
+
+	// 心跳没有过期的时候不重复发送
+	t.Run("skip heartbeat", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		cmd := mocks.NewMockCmdable(ctrl)
+		expectListHeartbeat(cmd, nil)
+		expectBLMove(cmd, "1", nil).Times(2)
+		q, err := NewRedisListQueue[int](cmd, "order", "c1", JSONCodec[int]{}, time.Minute)
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err := q.Dequeue(context.Background())
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestRedisListQueue_AckAndNack(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+		// 调用 Ack 或者 Nack
+		fn func(q *RedisListQueue[int]) error
+
+		wantErr error
+	}{
+		{
+			name: "acked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewIntCmd(context.Background())
+				res.SetVal(1)
+				cmd.EXPECT().LRem(gomock.Any(), "{order}:processing:c1", int64(1), []byte("123")).Return(res)
+				return cmd
+			},
+			fn: func(q *RedisListQueue[int]) error {
+				return q.Ack(context.Background(), 123)
+			},
+		},
+		{
+			// 心跳过期之后被回收了
+			name: "ack not in processing",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewIntCmd(context.Background())
+				res.SetVal(0)
+				cmd.EXPECT().LRem(gomock.Any(), "{order}:processing:c1", int64(1), []byte("123")).Return(res)
+				return cmd
+			},
+			fn: func(q *RedisListQueue[int]) error {
+				return q.Ack(context.Background(), 123)
+			},
+			wantErr: ErrNotInProcessing,
+		},
+		{
+			name: "nacked",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(1))
+				cmd.EXPECT().Eval(gomock.Any(), listNackLua,
+					[]string{"{order}:pending", "{order}:processing:c1"}, []byte("123")).
+					Return(res)
+				return cmd
+			},
+			fn: func(q *RedisListQueue[int]) error {
+				return q.Nack(context.Background(), 123)
+			},
+		},
+		{
+			name: "nack not in processing",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(gomock.Any(), listNackLua,
+					[]string{"{order}:pending", "{order}:processing:c1"}, []byte("123")).
+					Return(res)
+				return cmd
+			},
+			fn: func(q *RedisListQueue[int]) error {
+				return q.Nack(context.Background(), 123)
+			},
+			wantErr: ErrNotInProcessing,
+		},
+		{
+			name: "nack error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetErr(context.DeadlineExceeded)
+				cmd.EXPECT().Eval(gomock.Any(), listNackLua,
+					[]string{"{order}:pending", "{order}:processing:c1"}, []byte("123")).
+					Return(res)
+				return cmd
+			},
+			fn: func(q *RedisListQueue[int]) error {
+				return q.Nack(context.Background(), 123)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisListQueue[int](tc.mock(ctrl), "order", "c1", JSONCodec[int]{}, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantErr, tc.fn(q))
+		})
+	}
+}
+
+func TestRedisListQueue_Reap(t *testing.T) {
+	evalRes := func(val any, err error) *redis.Cmd {
+		res := redis.NewCmd(context.Background())
+		if err != nil {
+			res.SetErr(err)
+		} else {
+			res.SetVal(val)
+		}
+		return res
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) redis.Cmdable
+
+		wantErr error
+		wantCnt int64
+	}{
+		{
+			name: "reaped",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), listDeadLua, []string{"{order}:consumers"}).
+					Return(evalRes([]any{"c2", "c3"}, nil))
+				// 每个消费者的处理中列表都要作为 key 传进去
+				cmd.EXPECT().Eval(gomock.Any(), listReapLua,
+					[]string{"{order}:pending", "{order}:consumers",
+						"{order}:processing:c2", "{order}:processing:c3"}, "c2", "c3").
+					Return(evalRes(int64(3), nil))
+				return cmd
+			},
+			wantCnt: 3,
+		},
+		{
+			name: "no dead consumer",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), listDeadLua, []string{"{order}:consumers"}).
+					Return(evalRes([]any{}, nil))
+				return cmd
+			},
+		},
+		{
+			name: "eval error",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := mocks.NewMockCmdable(ctrl)
+				cmd.EXPECT().Eval(gomock.Any(), listDeadLua, []string{"{order}:consumers"}).
+					Return(evalRes(nil, context.DeadlineExceeded))
+				return cmd
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisListQueue[int](tc.mock(ctrl), "order", "c1", JSONCodec[int]{}, time.Minute)
+			require.NoError(t, err)
+			n, err := q.Reap(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCnt, n)
+		})
+	}
+}
+
+func TestNewRedisListQueue(t *testing.T) {
+	testCases := []struct {
+		name string
+		ttl  time.Duration
+
+		wantErr error
+	}{
+		{name: "valid", ttl: time.Millisecond},
+		{name: "zero", ttl: 0, wantErr: ErrInvalidTTL},
+		{name: "negative", ttl: -time.Second, wantErr: ErrInvalidTTL},
+		{name: "less than 1ms", ttl: time.Microsecond, wantErr: ErrInvalidTTL},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			q, err := NewRedisListQueue[int](mocks.NewMockCmdable(ctrl), "order", "c1", JSONCodec[int]{}, tc.ttl)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.ttl, q.ttl)
+		})
+	}
+}
+
+func expectListHeartbeat(cmd *mocks.MockCmdable, err error) *gomock.Call {
+	res := redis.NewCmd(context.Background())
+	if err != nil {
+		res.SetErr(err)
+	} else {
+		res.SetVal(int64(1))
+	}
+	return cmd.EXPECT().Eval(gomock.Any(), listHeartbeatLua, []string{"{order}:consumers"},
+		"c1", int64(60000)).
+		Return(res)
+}
+
+func expectBLMove(cmd *mocks.MockCmdable, val string, err error) *gomock.Call {
+	res := redis.NewStringCmd(context.Background())
+	if err != nil {
+		res.SetErr(err)
+	} else {
+		res.SetVal(val)
+	}
+	return cmd.EXPECT().BLMove(gomock.Any(), "{order}:pending", "{order}:processing:c1",
+		"RIGHT", "LEFT", redisListQueueBlockTimeout).
+		Return(res)
+}
@@ -0,0 +1,312 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var ErrTimingWheelClosed = errors.New("go_utils: 时间轮已经关闭")
+
+// TimingWheel 分层时间轮，适合管理大量的定时任务，例如连接的超时
+// 添加、取消和重新调度任务都是 O(1) 的，精度是一个 tick
+// 1. 第 0 层每个槽位代表一个 tick，第 i 层每个槽位代表 wheelSize^i 个 tick
+// 2. 任务按照剩余时间放到能容纳它的最低一层，超出最高一层的时候自动增加一层
+// 3. 时间推进到高层的某个槽位的时候，把里面的任务重新放到低层，直到第 0 层到期
+// 到期的任务按照到期时间的顺序交给 handler，handler 在时间轮自己的 goroutine 里执行，
+// 执行太久会推迟后面的任务，耗时的逻辑应该另起 goroutine
+// 使用完之后必须调用 Close
+type TimingWheel[T any] struct {
+	mu        sync.Mutex
+	tick      time.Duration
+	wheelSize int64
+	// levels[i] 是第 i 层，spans[i] 是第 i 层每个槽位代表的 tick 数量
+	levels [][]timerBucket[T]
+	spans  []int64
+	// 已经推进了多少个 tick
+	now int64
+	// 在时间轮上的任务数量
+	cnt int
+
+	handler func(val T)
+	// 从创建到现在过去了多久，测试的时候可以替换掉
+	elapsed func() time.Duration
+	closed  chan struct{}
+	once    sync.Once
+	done    chan struct{}
+}
+
+// NewTimingWheel 创建时间轮，每隔 tick 推进一个槽位，每一层有 wheelSize 个槽位
+// 任务到期的时候调用 handler
+func NewTimingWheel[T any](tick time.Duration, wheelSize int, handler func(val T)) (*TimingWheel[T], error) {
+	tw, err := newTimingWheel[T](tick, wheelSize)
+	if err != nil {
+		return nil, err
+	}
+	tw.handler = handler
+	go tw.run()
+	return tw, nil
+}
+
+// NewChanTimingWheel 创建时间轮，到期的任务发送到返回的 channel 里
+// channel 满了之后时间轮会暂停推进，直到有人读取或者时间轮关闭
+func NewChanTimingWheel[T any](tick time.Duration, wheelSize int, buffer int) (*TimingWheel[T], <-chan T, error) {
+	tw, err := newTimingWheel[T](tick, wheelSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan T, buffer)
+	tw.handler = func(val T) {
+		select {
+		case ch <- val:
+		case <-tw.closed:
+		}
+	}
+	go tw.run()
+	return tw, ch, nil
+}
+
+func newTimingWheel[T any](tick time.Duration, wheelSize int) (*TimingWheel[T], error) {
+	if tick <= 0 {
+		return nil, fmt.Errorf("go_utils: 非法的 tick %s", tick)
+	}
+	if wheelSize < 2 {
+		return nil, fmt.Errorf("go_utils: 非法的时间轮大小 %d", wheelSize)
+	}
+	start := time.Now()
+	tw := &TimingWheel[T]{
+		tick:      tick,
+		wheelSize: int64(wheelSize),
+		elapsed: func() time.Duration {
+			return time.Since(start)
+		},
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	tw.addLevel(1)
+	return tw, nil
+}
+
+// Add 添加任务，delay 之后到期，delay <= 0 的任务在下一个 tick 到期
+// 返回的 TimerTask 可以用来取消或者重新调度
+func (tw *TimingWheel[T]) Add(delay time.Duration, val T) (*TimerTask[T], error) {
+	task := &TimerTask[T]{Value: val, tw: tw}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.isClosed() {
+		return nil, ErrTimingWheelClosed
+	}
+	tw.schedule(task, delay)
+	return task, nil
+}
+
+// Len 还没有到期的任务数量
+func (tw *TimingWheel[T]) Len() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.cnt
+}
+
+// Close 停止推进时间轮，没有到期的任务会被丢弃
+// 会等待正在执行的 handler 返回，所以不能在 handler 里面调用
+func (tw *TimingWheel[T]) Close() {
+	tw.once.Do(func() {
+		tw.mu.Lock()
+		close(tw.closed)
+		tw.mu.Unlock()
+	})
+	<-tw.done
+}
+
+func (tw *TimingWheel[T]) isClosed() bool {
+	select {
+	case <-tw.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (tw *TimingWheel[T]) run() {
+	defer close(tw.done)
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// handler 执行太久的话会落后好几个 tick，这里一次性追上
+			tw.advanceTo(int64(tw.elapsed() / tw.tick))
+		case <-tw.closed:
+			return
+		}
+	}
+}
+
+// advanceTo 一个 tick 一个 tick 地推进到 target，每推进一个 tick 就执行到期的任务
+func (tw *TimingWheel[T]) advanceTo(target int64) {
+	var expired []T
+	for {
+		tw.mu.Lock()
+		if tw.now >= target || tw.isClosed() {
+			tw.mu.Unlock()
+			return
+		}
+		tw.now++
+		expired = tw.advance(expired[:0])
+		tw.mu.Unlock()
+		for _, val := range expired {
+			tw.handler(val)
+		}
+	}
+}
+
+// advance 处理刚刚推进到的 tick，把到期的任务追加到 expired 后面
+func (tw *TimingWheel[T]) advance(expired []T) []T {
+	// 从高层往低层降级，降级之后的任务可能落到第 0 层当前的槽位
+	for i := len(tw.levels) - 1; i >= 0; i-- {
+		span := tw.spans[i]
+		if tw.now%span != 0 {
+			continue
+		}
+		bucket := &tw.levels[i][(tw.now/span)%tw.wheelSize]
+		for task := bucket.takeAll(); task != nil; {
+			next := task.next
+			task.prev, task.next = nil, nil
+			if !tw.place(task) {
+				tw.cnt--
+				expired = append(expired, task.Value)
+			}
+			task = next
+		}
+	}
+	return expired
+}
+
+// schedule 计算到期的 tick 并放到时间轮上，必须持有锁
+func (tw *TimingWheel[T]) schedule(task *TimerTask[T], delay time.Duration) {
+	// 按照真实的时间计算，向上取整，保证不会提前到期
+	elapsed := tw.elapsed()
+	deadline := elapsed + delay
+	if delay > 0 && deadline < elapsed {
+		// 溢出了
+		deadline = math.MaxInt64
+	}
+	expiration := int64(deadline / tw.tick)
+	if deadline%tw.tick > 0 {
+		expiration++
+	}
+	task.expiration = max(expiration, tw.now+1)
+	tw.place(task)
+	tw.cnt++
+}
+
+// place 把任务放到能容纳它的最低一层，任务已经到期的时候返回 false
+func (tw *TimingWheel[T]) place(task *TimerTask[T]) bool {
+	remain := task.expiration - tw.now
+	if remain <= 0 {
+		return false
+	}
+	level := 0
+	for remain >= tw.spans[level]*tw.wheelSize {
+		if level == len(tw.levels)-1 && !tw.addLevel(tw.spans[level]*tw.wheelSize) {
+			// 已经没办法再加一层了，放在最高一层，降级的时候会被重新放回来
+			break
+		}
+		level++
+	}
+	span := tw.spans[level]
+	tw.levels[level][(task.expiration/span)%tw.wheelSize].push(task)
+	return true
+}
+
+// addLevel 增加一层，span 溢出的时候返回 false
+func (tw *TimingWheel[T]) addLevel(span int64) bool {
+	if span <= 0 || span > math.MaxInt64/tw.wheelSize {
+		return false
+	}
+	buckets := make([]timerBucket[T], tw.wheelSize)
+	for i := range buckets {
+		buckets[i].init()
+	}
+	tw.levels = append(tw.levels, buckets)
+	tw.spans = append(tw.spans, span)
+	return true
+}
+
+// TimerTask 时间轮上的任务
+type TimerTask[T any] struct {
+	Value T
+
+	tw *TimingWheel[T]
+	// 到期的 tick
+	expiration int64
+	// 所在的槽位，nil 说明已经到期或者被取消了
+	bucket     *timerBucket[T]
+	prev, next *TimerTask[T]
+}
+
+// Cancel 取消任务，任务已经到期或者已经被取消的时候返回 false
+func (t *TimerTask[T]) Cancel() bool {
+	t.tw.mu.Lock()
+	defer t.tw.mu.Unlock()
+	return t.remove()
+}
+
+// Reschedule 重新调度任务，delay 之后到期
+// 已经到期或者被取消的任务也会被重新放回时间轮，返回值表示重新调度之前任务是否还在等待到期
+func (t *TimerTask[T]) Reschedule(delay time.Duration) (bool, error) {
+	t.tw.mu.Lock()
+	defer t.tw.mu.Unlock()
+	if t.tw.isClosed() {
+		return false, ErrTimingWheelClosed
+	}
+	pending := t.remove()
+	t.tw.schedule(t, delay)
+	return pending, nil
+}
+
+// remove 把任务从时间轮上摘下来，必须持有锁
+func (t *TimerTask[T]) remove() bool {
+	if t.bucket == nil {
+		return false
+	}
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev, t.next, t.bucket = nil, nil, nil
+	t.tw.cnt--
+	return true
+}
+
+// timerBucket 槽位，带哨兵的双向循环链表
+type timerBucket[T any] struct {
+	root TimerTask[T]
+}
+
+func (b *timerBucket[T]) init() {
+	b.root.prev = &b.root
+	b.root.next = &b.root
+}
+
+func (b *timerBucket[T]) push(task *TimerTask[T]) {
+	task.bucket = b
+	task.prev = b.root.prev
+	task.next = &b.root
+	b.root.prev.next = task
+	b.root.prev = task
+}
+
+// takeAll 清空槽位，返回以 nil 结尾的任务链表，保持插入的顺序
+func (b *timerBucket[T]) takeAll() *TimerTask[T] {
+	if b.root.next == &b.root {
+		return nil
+	}
+	first := b.root.next
+	b.root.prev.next = nil
+	b.init()
+	for task := first; task != nil; task = task.next {
+		task.bucket = nil
+	}
+	return first
+}
@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimingWheel(t *testing.T) {
+	testCases := []struct {
+		name      string
+		tick      time.Duration
+		wheelSize int
+
+		wantErr bool
+	}{
+		{name: "valid", tick: time.Millisecond, wheelSize: 2},
+		{name: "invalid tick", tick: 0, wheelSize: 8, wantErr: true},
+		{name: "invalid wheel size", tick: time.Millisecond, wheelSize: 1, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tw, err := NewTimingWheel[int](tc.tick, tc.wheelSize, func(val int) {})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tw.Close()
+		})
+	}
+}
+
+func TestTimingWheel_Expire(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 到期时间，单位 tick，值就是到期时间
+		delays []int
+		// 推进多少个 tick
+		advance int64
+
+		wantVals []int
+	}{
+		{
+			name:     "first level",
+			delays:   []int{3, 1, 2},
+			advance:  3,
+			wantVals: []int{1, 2, 3},
+		},
+		{
+			name:     "not expired",
+			delays:   []int{3, 5},
+			advance:  4,
+			wantVals: []int{3},
+		},
+		{
+			// 超出第 0 层，从高层降级下来
+			name:     "overflow wheels",
+			delays:   []int{100, 4, 17, 64, 63, 65},
+			advance:  100,
+			wantVals: []int{4, 17, 63, 64, 65, 100},
+		},
+		{
+			name:     "non positive delay",
+			delays:   []int{0, -1},
+			advance:  1,
+			wantVals: []int{0, -1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tw, got := newManualTimingWheel(t, 4)
+			for _, d := range tc.delays {
+				_, err := tw.Add(time.Duration(d)*time.Millisecond, d)
+				require.NoError(t, err)
+			}
+			tw.advanceTo(tc.advance)
+			assert.Equal(t, tc.wantVals, *got)
+			assert.Equal(t, len(tc.delays)-len(tc.wantVals), tw.Len())
+		})
+	}
+}
+
+func TestTimingWheel_ExactTick(t *testing.T) {
+	// 每个任务都在到期的那个 tick 执行，不早也不晚
+	tw, got := newManualTimingWheel(t, 3)
+	for d := 1; d <= 200; d++ {
+		_, err := tw.Add(time.Duration(d)*time.Millisecond, d)
+		require.NoError(t, err)
+	}
+	for now := int64(1); now <= 200; now++ {
+		tw.advanceTo(now)
+		require.Equal(t, int(now), len(*got))
+		assert.Equal(t, int(now), (*got)[now-1])
+	}
+	assert.Equal(t, 0, tw.Len())
+}
+
+func TestTimingWheel_Cancel(t *testing.T) {
+	tw, got := newManualTimingWheel(t, 4)
+	task1, err := tw.Add(time.Millisecond*2, 1)
+	require.NoError(t, err)
+	task2, err := tw.Add(time.Millisecond*30, 2)
+	require.NoError(t, err)
+	_, err = tw.Add(time.Millisecond*3, 3)
+	require.NoError(t, err)
+
+	assert.True(t, task1.Cancel())
+	assert.False(t, task1.Cancel())
+	// 在高层的任务也能取消
+	assert.True(t, task2.Cancel())
+	assert.Equal(t, 1, tw.Len())
+	tw.advanceTo(40)
+	assert.Equal(t, []int{3}, *got)
+}
+
+func TestTimingWheel_Reschedule(t *testing.T) {
+	tw, got := newManualTimingWheel(t, 4)
+	task1, err := tw.Add(time.Millisecond*2, 1)
+	require.NoError(t, err)
+	_, err = tw.Add(time.Millisecond*5, 2)
+	require.NoError(t, err)
+
+	// 推迟
+	pending, err := task1.Reschedule(time.Millisecond * 10)
+	require.NoError(t, err)
+	assert.True(t, pending)
+	tw.advanceTo(5)
+	assert.Equal(t, []int{2}, *got)
+
+	// 到期之前再次推迟，从当前时间开始算
+	pending, err = task1.Reschedule(time.Millisecond * 10)
+	require.NoError(t, err)
+	assert.True(t, pending)
+	tw.advanceTo(14)
+	assert.Equal(t, []int{2}, *got)
+	tw.advanceTo(15)
+	assert.Equal(t, []int{2, 1}, *got)
+
+	// 已经到期的任务重新放回去
+	pending, err = task1.Reschedule(time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, pending)
+	tw.advanceTo(16)
+	assert.Equal(t, []int{2, 1, 1}, *got)
+}
+
+func TestTimingWheel_Handler(t *testing.T) {
+	res := make(chan int, 3)
+	tw, err := NewTimingWheel[int](time.Millisecond, 8, func(val int) {
+		res <- val
+	})
+	require.NoError(t, err)
+	defer tw.Close()
+	start := time.Now()
+	_, err = tw.Add(time.Millisecond*30, 2)
+	require.NoError(t, err)
+	_, err = tw.Add(time.Millisecond*10, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, <-res)
+	assert.True(t, time.Since(start) >= time.Millisecond*10)
+	assert.Equal(t, 2, <-res)
+	assert.True(t, time.Since(start) >= time.Millisecond*30)
+}
+
+func TestTimingWheel_Chan(t *testing.T) {
+	tw, ch, err := NewChanTimingWheel[int](time.Millisecond, 8, 0)
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		_, err = tw.Add(time.Millisecond*time.Duration(i), i)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, <-ch)
+	// 没有人读取的时候阻塞住，关闭的时候不能卡住
+	time.Sleep(time.Millisecond * 10)
+	tw.Close()
+	_, err = tw.Add(time.Millisecond, 4)
+	assert.Equal(t, ErrTimingWheelClosed, err)
+	// 重复关闭
+	tw.Close()
+}
+
+// newManualTimingWheel 手动推进的时间轮，tick 为 1ms，时间只会随着 advanceTo 前进
+func newManualTimingWheel(t *testing.T, wheelSize int) (*TimingWheel[int], *[]int) {
+	tw, err := newTimingWheel[int](time.Millisecond, wheelSize)
+	require.NoError(t, err)
+	got := &[]int{}
+	tw.handler = func(val int) {
+		*got = append(*got, val)
+	}
+	tw.elapsed = func() time.Duration {
+		return time.Duration(tw.now) * time.Millisecond
+	}
+	return tw, got
+}
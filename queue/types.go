@@ -3,6 +3,7 @@ package queue
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 type Queue[T any] interface {
@@ -10,9 +11,54 @@ type Queue[T any] interface {
 	Dequeue(ctx context.Context) (T, error)
 }
 
+// NonBlockingQueue 不阻塞的队列操作，队列满了返回 ErrOutOfCapacity，队列为空返回 ErrEmptyQueue
+// 已经关闭的队列，TryEnqueue 返回 ErrQueueClosed，取完之后 TryDequeue 也返回 ErrQueueClosed
+type NonBlockingQueue[T any] interface {
+	TryEnqueue(val T) error
+	TryDequeue() (T, error)
+	// Peek 查看下一个出队的元素，但是不出队，也不会复制整个队列
+	Peek() (T, error)
+	Len() int
+	// Cap 无界队列返回 0
+	Cap() int
+}
+
+// BlockingQueue 阻塞队列，同时支持阻塞和不阻塞的操作
+type BlockingQueue[T any] interface {
+	Queue[T]
+	NonBlockingQueue[T]
+}
+
+// BatchQueue 支持批量操作的队列，批量操作只会加一次锁
+// DelayQueue 的批量出队只会返回已经到期的元素
+type BatchQueue[T any] interface {
+	Queue[T]
+	// EnqueueBatch 批量入队，要么全部入队，要么全部不入队
+	// 空间不够的时候阻塞，直到能够放下所有元素或者 ctx 过期
+	// vals 的数量超过队列容量的时候，返回 ErrOutOfCapacity
+	EnqueueBatch(ctx context.Context, vals []T) error
+	// DequeueBatch 批量出队，最多返回 max 个元素
+	// 队列为空的时候阻塞，直到拿到第一个元素或者 ctx 过期
+	// 拿到第一个元素之后，最多再等待 maxWait 凑满 max 个元素
+	// 等待期间 ctx 过期的话，返回已经拿到的元素，不会返回错误，避免元素丢失
+	DequeueBatch(ctx context.Context, max int, maxWait time.Duration) ([]T, error)
+	// DrainTo 不阻塞地取出队列中所有的元素，追加到 dst 后面并返回
+	DrainTo(dst []T) []T
+}
+
+// Deque 双端队列，两端都可以入队和出队
+type Deque[T any] interface {
+	PushFront(ctx context.Context, val T) error
+	PushBack(ctx context.Context, val T) error
+	PopFront(ctx context.Context) (T, error)
+	PopBack(ctx context.Context) (T, error)
+}
+
 type cond struct {
 	single chan struct{}
 	l      sync.Locker
+	// 队列已经关闭，被唤醒的等待者需要检查这个字段，必须在锁范围内读写
+	closed bool
 }
 
 func newCond(l sync.Locker) *cond {
@@ -43,6 +89,83 @@ func (c *cond) broadcast() {
 	close(old)
 }
 
+// close 标记关闭并唤醒所有等待者
+// 必须加锁之后才能调用这个方法，调用之后锁会被释放
+func (c *cond) close() {
+	c.closed = true
+	c.broadcast()
+}
+
+// closeQueue 关闭阻塞队列，唤醒所有等待入队和出队的人，调用前不需要加锁
+// 关闭之后入队返回 ErrQueueClosed，出队取完剩下的元素之后返回 ErrQueueClosed
+// 已经关闭过的返回 false
+func closeQueue(mu sync.Locker, readCond, writeCond *cond) bool {
+	mu.Lock()
+	if writeCond.closed {
+		mu.Unlock()
+		return false
+	}
+	writeCond.close()
+	mu.Lock()
+	readCond.close()
+	return true
+}
+
+// closeAndDrain 关闭队列，然后等待消费者取完剩下的元素，调用前不需要加锁
+// ctx 过期的时候还没有被取走的元素会被全部取出来返回
+func closeAndDrain[T any](ctx context.Context,
+	mu sync.Locker,
+	readCond, writeCond *cond,
+	q unsafeQueue[T]) []T {
+	closeQueue(mu, readCond, writeCond)
+	mu.Lock()
+	for q.length() > 0 {
+		// 每次出队都会唤醒 writeCond
+		ch := writeCond.signalCh()
+		select {
+		case <-ctx.Done():
+			return drainTo[T](mu, writeCond, q, nil)
+		case <-ch:
+			mu.Lock()
+		}
+	}
+	mu.Unlock()
+	return nil
+}
+
+// tryEnqueue 不阻塞入队的通用逻辑，调用前不需要加锁
+func tryEnqueue[T any](mu sync.Locker, readCond, writeCond *cond, q unsafeQueue[T], val T) error {
+	mu.Lock()
+	if writeCond.closed {
+		mu.Unlock()
+		return ErrQueueClosed
+	}
+	if q.bounded() && q.length() >= q.capacity() {
+		mu.Unlock()
+		return ErrOutOfCapacity
+	}
+	q.push(val)
+	readCond.broadcast()
+	return nil
+}
+
+// tryDequeue 不阻塞出队的通用逻辑，调用前不需要加锁
+func tryDequeue[T any](mu sync.Locker, readCond, writeCond *cond, q unsafeQueue[T]) (T, error) {
+	mu.Lock()
+	if q.length() == 0 {
+		closed := readCond.closed
+		mu.Unlock()
+		var t T
+		if closed {
+			return t, ErrQueueClosed
+		}
+		return t, ErrEmptyQueue
+	}
+	res := q.pop()
+	writeCond.broadcast()
+	return res, nil
+}
+
 // Comparator 用于比较两个对象的大小 src < dst, 返回-1，src = dst, 返回0，src > dst, 返回1
 // 不要返回任何其它值！
 type Comparator[T any] func(src T, dst T) int
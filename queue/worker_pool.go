@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrWorkerPoolClosed = errors.New("go_utils: 工作池已经关闭")
+
+// workerPoolDequeueRetryInterval 出队返回错误之后，等待多久再出队，避免 redis 之类的队列出问题的时候空转
+const workerPoolDequeueRetryInterval = time.Millisecond * 100
+
+// PanicError handler panic 之后转换成的错误
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("go_utils: 任务 panic: %v\n%s", p.Value, p.Stack)
+}
+
+// RetryStrategy 任务失败之后的重试策略，cache 包里面的重试策略都可以直接使用
+type RetryStrategy interface {
+	// Next 返回下一次重试的间隔，false 表示不再重试
+	Next() (time.Duration, bool)
+}
+
+type workerPoolOptions struct {
+	workers  int
+	timeout  time.Duration
+	newRetry func() RetryStrategy
+}
+
+type WorkerPoolOption func(o *workerPoolOptions)
+
+// WithWorkers 初始的 worker 数量，默认为 CPU 核数，之后可以通过 Resize 调整
+func WithWorkers(n int) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.workers = n
+	}
+}
+
+// WithTaskTimeout 单次执行任务的超时时间，超时之后 handler 的 ctx 会被取消，默认不限制
+func WithTaskTimeout(timeout time.Duration) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithTaskRetry handler 返回错误或者 panic 的时候重试，默认不重试
+// 每个任务第一次失败的时候调用 newRetry 拿到一个全新的重试策略，所以策略之间不会共享状态
+func WithTaskRetry(newRetry func() RetryStrategy) WorkerPoolOption {
+	return func(o *workerPoolOptions) {
+		o.newRetry = newRetry
+	}
+}
+
+// WorkerPool 从队列里面取出任务，交给多个 worker 并发执行
+// 1. handler panic 会被恢复并转换成 PanicError，和 handler 返回错误一样处理
+// 2. 失败的任务按照重试策略重试，重试用完之后交给 OnFailure 设置的回调
+// 3. 队列返回 ErrQueueClosed 之后，worker 会退出
+type WorkerPool[T any] struct {
+	q         Queue[T]
+	handler   func(ctx context.Context, val T) error
+	timeout   time.Duration
+	newRetry  func() RetryStrategy
+	onFailure atomic.Pointer[func(val T, err error)]
+
+	mu sync.Mutex
+	// 每个 worker 的退出信号
+	workers []context.CancelFunc
+	closed  bool
+	wg      sync.WaitGroup
+	// 所有任务的 ctx 都派生自 taskCtx，Shutdown 超时的时候取消
+	taskCtx    context.Context
+	cancelTask context.CancelFunc
+}
+
+// NewWorkerPool 创建并启动工作池
+func NewWorkerPool[T any](q Queue[T],
+	handler func(ctx context.Context, val T) error,
+	opts ...WorkerPoolOption) (*WorkerPool[T], error) {
+	o := workerPoolOptions{workers: runtime.NumCPU()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.workers < 0 {
+		return nil, fmt.Errorf("go_utils: 非法的 worker 数量 %d", o.workers)
+	}
+	p := &WorkerPool[T]{
+		q:        q,
+		handler:  handler,
+		timeout:  o.timeout,
+		newRetry: o.newRetry,
+	}
+	p.taskCtx, p.cancelTask = context.WithCancel(context.Background())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resize(o.workers)
+	return p, nil
+}
+
+// OnFailure 设置任务最终失败的时候的回调，例如记录日志或者放入死信队列
+// 只对设置之后失败的任务生效，所以应该在任务入队之前设置
+func (p *WorkerPool[T]) OnFailure(fn func(val T, err error)) {
+	p.onFailure.Store(&fn)
+}
+
+// Size 当前的 worker 数量
+func (p *WorkerPool[T]) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+// Resize 调整 worker 数量，n 为 0 的时候暂停消费
+// 被移除的 worker 会执行完手上的任务再退出
+func (p *WorkerPool[T]) Resize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("go_utils: 非法的 worker 数量 %d", n)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrWorkerPoolClosed
+	}
+	p.resize(n)
+	return nil
+}
+
+// resize 必须持有锁
+func (p *WorkerPool[T]) resize(n int) {
+	for len(p.workers) < n {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.workers = append(p.workers, cancel)
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+	for len(p.workers) > n {
+		last := len(p.workers) - 1
+		p.workers[last]()
+		p.workers = p.workers[:last]
+	}
+}
+
+// Shutdown 停止从队列里取任务，并且等待正在执行的任务结束
+// ctx 过期的时候取消所有任务的 ctx，不再等待，返回 ctx.Err()
+func (p *WorkerPool[T]) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrWorkerPoolClosed
+	}
+	p.closed = true
+	p.resize(0)
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	defer p.cancelTask()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool[T]) work(ctx context.Context) {
+	defer p.wg.Done()
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		val, err := p.q.Dequeue(ctx)
+		if ctx.Err() != nil || errors.Is(err, ErrQueueClosed) {
+			// 被 Resize 或者 Shutdown 移除了，或者队列已经关闭并且取完了
+			// 出队和退出信号同时发生的时候，手上的任务还是要执行完
+			if err == nil {
+				p.process(val)
+			}
+			return
+		}
+		if err != nil {
+			// 走到这里的时候 timer 要么还没创建，要么已经触发并且被读取了，可以直接 Reset
+			if timer == nil {
+				timer = time.NewTimer(workerPoolDequeueRetryInterval)
+			} else {
+				timer.Reset(workerPoolDequeueRetryInterval)
+			}
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		p.process(val)
+	}
+}
+
+// process 执行任务，失败的时候按照重试策略重试
+func (p *WorkerPool[T]) process(val T) {
+	var retry RetryStrategy
+	for {
+		err := p.run(val)
+		if err == nil {
+			return
+		}
+		if p.newRetry == nil {
+			p.fail(val, err)
+			return
+		}
+		if retry == nil {
+			retry = p.newRetry()
+		}
+		interval, ok := retry.Next()
+		if !ok {
+			p.fail(val, err)
+			return
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-p.taskCtx.Done():
+			timer.Stop()
+			p.fail(val, errors.Join(err, p.taskCtx.Err()))
+			return
+		}
+	}
+}
+
+// run 执行一次 handler，panic 会被转换成 PanicError
+func (p *WorkerPool[T]) run(val T) (err error) {
+	ctx := p.taskCtx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return p.handler(ctx, val)
+}
+
+func (p *WorkerPool[T]) fail(val T, err error) {
+	if fn := p.onFailure.Load(); fn != nil && *fn != nil {
+		(*fn)(val, err)
+	}
+}
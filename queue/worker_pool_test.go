@@ -0,0 +1,315 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWorkerPool(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []WorkerPoolOption
+
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "invalid workers", opts: []WorkerPoolOption{WithWorkers(-1)}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewConcurrentLinkedBlockingQueue[int](0)
+			p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+				return nil
+			}, tc.opts...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, p.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestWorkerPool_Process(t *testing.T) {
+	q := NewConcurrentLinkedBlockingQueue[int](0)
+	var mu sync.Mutex
+	var got []int
+	p, err := NewWorkerPool(q, func(ctx context.Context, val int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, val)
+		return nil
+	}, WithWorkers(4))
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, q.Enqueue(context.Background(), i))
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 100
+	}, time.Second, time.Millisecond)
+	require.NoError(t, p.Shutdown(context.Background()))
+	assert.ElementsMatch(t, seq(100), got)
+}
+
+func TestWorkerPool_Failure(t *testing.T) {
+	mockErr := errors.New("mock error")
+	testCases := []struct {
+		name    string
+		handler func(ctx context.Context, val int) error
+		opts    []WorkerPoolOption
+
+		// 一共执行了几次
+		wantCalls int32
+		wantErr   func(t *testing.T, err error)
+	}{
+		{
+			name: "no retry",
+			handler: func(ctx context.Context, val int) error {
+				return mockErr
+			},
+			wantCalls: 1,
+			wantErr: func(t *testing.T, err error) {
+				assert.Equal(t, mockErr, err)
+			},
+		},
+		{
+			name: "retry exhausted",
+			handler: func(ctx context.Context, val int) error {
+				return mockErr
+			},
+			opts:      []WorkerPoolOption{WithTaskRetry(fixedRetry(time.Millisecond, 2))},
+			wantCalls: 3,
+			wantErr: func(t *testing.T, err error) {
+				assert.Equal(t, mockErr, err)
+			},
+		},
+		{
+			name: "panic",
+			handler: func(ctx context.Context, val int) error {
+				panic("mock panic")
+			},
+			opts:      []WorkerPoolOption{WithTaskRetry(fixedRetry(time.Millisecond, 1))},
+			wantCalls: 2,
+			wantErr: func(t *testing.T, err error) {
+				var panicErr *PanicError
+				require.True(t, errors.As(err, &panicErr))
+				assert.Equal(t, "mock panic", panicErr.Value)
+			},
+		},
+		{
+			name: "task timeout",
+			handler: func(ctx context.Context, val int) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			opts:      []WorkerPoolOption{WithTaskTimeout(time.Millisecond * 10)},
+			wantCalls: 1,
+			wantErr: func(t *testing.T, err error) {
+				assert.Equal(t, context.DeadlineExceeded, err)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := NewConcurrentLinkedBlockingQueue[int](0)
+			var calls atomic.Int32
+			failed := make(chan error, 1)
+			p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+				calls.Add(1)
+				return tc.handler(ctx, val)
+			}, append(tc.opts, WithWorkers(1))...)
+			require.NoError(t, err)
+			defer p.Shutdown(context.Background())
+			p.OnFailure(func(val int, err error) {
+				assert.Equal(t, 123, val)
+				failed <- err
+			})
+			require.NoError(t, q.Enqueue(context.Background(), 123))
+			tc.wantErr(t, <-failed)
+			assert.Equal(t, tc.wantCalls, calls.Load())
+		})
+	}
+
+	// 每个任务都有自己的重试策略，不会用掉别的任务的重试次数
+	t.Run("retry per task", func(t *testing.T) {
+		q := NewConcurrentLinkedBlockingQueue[int](0)
+		var calls atomic.Int32
+		failed := make(chan int, 2)
+		p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+			calls.Add(1)
+			return mockErr
+		}, WithWorkers(1), WithTaskRetry(fixedRetry(time.Millisecond, 1)))
+		require.NoError(t, err)
+		defer p.Shutdown(context.Background())
+		p.OnFailure(func(val int, err error) {
+			failed <- val
+		})
+		require.NoError(t, q.EnqueueBatch(context.Background(), []int{1, 2}))
+		assert.Equal(t, 1, <-failed)
+		assert.Equal(t, 2, <-failed)
+		assert.Equal(t, int32(4), calls.Load())
+	})
+
+	// 重试之后成功了
+	t.Run("retry succeeded", func(t *testing.T) {
+		q := NewConcurrentLinkedBlockingQueue[int](0)
+		var calls atomic.Int32
+		done := make(chan struct{})
+		p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+			if calls.Add(1) < 3 {
+				return mockErr
+			}
+			close(done)
+			return nil
+		}, WithWorkers(1), WithTaskRetry(fixedRetry(time.Millisecond, 5)))
+		require.NoError(t, err)
+		p.OnFailure(func(val int, err error) {
+			t.Error("不应该失败")
+		})
+		require.NoError(t, q.Enqueue(context.Background(), 1))
+		<-done
+		require.NoError(t, p.Shutdown(context.Background()))
+		assert.Equal(t, int32(3), calls.Load())
+	})
+}
+
+func TestWorkerPool_Resize(t *testing.T) {
+	q := NewConcurrentLinkedBlockingQueue[int](0)
+	var running, maxRunning atomic.Int32
+	release := make(chan struct{})
+	p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		return nil
+	}, WithWorkers(2))
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.Size())
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Enqueue(context.Background(), i))
+	}
+	assert.Eventually(t, func() bool {
+		return running.Load() == 2
+	}, time.Second, time.Millisecond)
+
+	// 扩容之后并发执行的任务变多
+	require.NoError(t, p.Resize(5))
+	assert.Equal(t, 5, p.Size())
+	assert.Eventually(t, func() bool {
+		return running.Load() == 5
+	}, time.Second, time.Millisecond)
+
+	// 缩容之后，被移除的 worker 执行完手上的任务才退出
+	require.NoError(t, p.Resize(0))
+	assert.Equal(t, int32(5), running.Load())
+	close(release)
+	assert.Eventually(t, func() bool {
+		return running.Load() == 0
+	}, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond * 10)
+	assert.Equal(t, 5, q.Len())
+	assert.Equal(t, int32(5), maxRunning.Load())
+	assert.Error(t, p.Resize(-1))
+
+	require.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, ErrWorkerPoolClosed, p.Resize(1))
+	assert.Equal(t, ErrWorkerPoolClosed, p.Shutdown(context.Background()))
+}
+
+func TestWorkerPool_Shutdown(t *testing.T) {
+	t.Run("wait for in-flight tasks", func(t *testing.T) {
+		q := NewConcurrentLinkedBlockingQueue[int](0)
+		var finished atomic.Int32
+		p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+			time.Sleep(time.Millisecond * 50)
+			finished.Add(1)
+			return nil
+		}, WithWorkers(3))
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, q.Enqueue(context.Background(), i))
+		}
+		time.Sleep(time.Millisecond * 10)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, p.Shutdown(ctx))
+		assert.Equal(t, int32(3), finished.Load())
+	})
+
+	t.Run("timeout cancels tasks", func(t *testing.T) {
+		q := NewConcurrentLinkedBlockingQueue[int](0)
+		taskErr := make(chan error, 1)
+		p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+			<-ctx.Done()
+			taskErr <- ctx.Err()
+			return ctx.Err()
+		}, WithWorkers(1))
+		require.NoError(t, err)
+		require.NoError(t, q.Enqueue(context.Background(), 1))
+		time.Sleep(time.Millisecond * 10)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, p.Shutdown(ctx))
+		assert.Equal(t, context.Canceled, <-taskErr)
+	})
+
+	// 队列关闭并且取完之后，worker 自己退出
+	t.Run("queue closed", func(t *testing.T) {
+		q := NewConcurrentLinkedBlockingQueue[int](0)
+		var finished atomic.Int32
+		p, err := NewWorkerPool[int](q, func(ctx context.Context, val int) error {
+			finished.Add(1)
+			return nil
+		}, WithWorkers(2))
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, q.Enqueue(context.Background(), i))
+		}
+		q.Close()
+		p.wg.Wait()
+		assert.Equal(t, int32(5), finished.Load())
+		require.NoError(t, p.Shutdown(context.Background()))
+	})
+}
+
+func seq(n int) []int {
+	res := make([]int, n)
+	for i := range res {
+		res[i] = i
+	}
+	return res
+}
+
+// fixedRetry 每次都返回一个新的固定间隔重试策略，最多重试 maxCnt 次
+func fixedRetry(interval time.Duration, maxCnt int) func() RetryStrategy {
+	return func() RetryStrategy {
+		return &fixedRetryStrategy{interval: interval, maxCnt: maxCnt}
+	}
+}
+
+type fixedRetryStrategy struct {
+	interval time.Duration
+	maxCnt   int
+	cnt      int
+}
+
+func (f *fixedRetryStrategy) Next() (time.Duration, bool) {
+	f.cnt++
+	return f.interval, f.cnt <= f.maxCnt
+}